@@ -3,6 +3,12 @@ package main
 import (
 	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	// The image is built FROM scratch, so quota time zones need the embedded
+	// database.
+	_ "time/tzdata"
 
 	"github.com/xavierpms/rate-limiter/internal/app"
 	"github.com/xavierpms/rate-limiter/internal/config"
@@ -22,5 +28,8 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	return runApplication(context.Background(), cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return runApplication(ctx, cfg)
 }
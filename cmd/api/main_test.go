@@ -52,7 +52,7 @@ func TestRun_ReturnsRunnerError(t *testing.T) {
 			t.Fatalf("expected config %#v, got %#v", loadedConfig, cfg)
 		}
 		if _, ok := ctx.Deadline(); ok {
-			t.Fatal("did not expect deadline on background context")
+			t.Fatal("did not expect deadline on signal context")
 		}
 		return expectedErr
 	}
@@ -91,6 +91,9 @@ func TestRun_Success(t *testing.T) {
 		if ctx == nil {
 			t.Fatal("expected non-nil context")
 		}
+		if ctx.Err() != nil {
+			t.Fatalf("expected live context before a signal, got %v", ctx.Err())
+		}
 		return nil
 	}
 
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc"
+
+	"github.com/xavierpms/rate-limiter/internal/config"
+	"github.com/xavierpms/rate-limiter/internal/rls"
+)
+
+func NewGRPCServer(cfg config.Config, limiter rls.Limiter) *grpc.Server {
+	server := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(server, rls.NewServer(limiter, cfg.CleanupInterval))
+	return server
+}
+
+// stopGRPC waits for in-flight RPCs until ctx expires and then forces the
+// remaining ones to close.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+		<-stopped
+	}
+}
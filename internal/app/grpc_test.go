@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/xavierpms/rate-limiter/internal/config"
+	"github.com/xavierpms/rate-limiter/internal/database"
+	"github.com/xavierpms/rate-limiter/internal/usecase"
+)
+
+func TestNewGRPCServer_ServesRateLimitService(t *testing.T) {
+	cfg := config.Config{DefaultLimit: 1, CleanupInterval: time.Second}
+	tokens := database.NewTokenLimitList("")
+	limiter := usecase.NewIpRateLimiter(context.Background(), cfg.DefaultLimit, 0, time.Minute, &tokens, database.NewMemoryRateLimitRepository(1, 0, 0))
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewGRPCServer(cfg, limiter)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		stopGRPC(context.Background(), server)
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	client := rlsv3.NewRateLimitServiceClient(conn)
+	req := &rlsv3.RateLimitRequest{
+		Domain: "edge",
+		Descriptors: []*corev3.RateLimitDescriptor{{
+			Entries: []*corev3.RateLimitDescriptor_Entry{{Key: "remote_address", Value: "203.0.113.9"}},
+		}},
+	}
+
+	expected := []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OVER_LIMIT}
+	for i, code := range expected {
+		resp, err := client.ShouldRateLimit(context.Background(), req)
+		if err != nil {
+			t.Fatalf("call %d failed: %v", i+1, err)
+		}
+		if resp.GetOverallCode() != code {
+			t.Fatalf("expected call %d to return %s, got %s", i+1, code, resp.GetOverallCode())
+		}
+	}
+}
@@ -2,47 +2,341 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"expvar"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+
+	"google.golang.org/grpc"
 
 	"github.com/xavierpms/rate-limiter/internal/config"
 	"github.com/xavierpms/rate-limiter/internal/database"
-	"github.com/xavierpms/rate-limiter/internal/usecase"
+	"github.com/xavierpms/rate-limiter/internal/jwt"
+	"github.com/xavierpms/rate-limiter/internal/policy"
 	"github.com/xavierpms/rate-limiter/internal/web/handler"
 	"github.com/xavierpms/rate-limiter/internal/web/middleware"
+	"github.com/xavierpms/rate-limiter/internal/web/proxy"
+	"github.com/xavierpms/rate-limiter/pkg/ratelimit"
 )
 
-func NewHTTPHandler(limiter middleware.Limiter) http.Handler {
+func NewHTTPHandler(limiter middleware.Limiter, opts []ratelimit.MiddlewareOption, circuitState func() string, readiness ...handler.HealthCheck) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/hello", handler.HelloWorldHandler)
+	return withOperationalRoutes(api, limiter, opts, circuitState, readiness...)
+}
+
+// NewProxyHTTPHandler rate limits every request and forwards the allowed ones
+// to upstream, whatever their path: the operational routes are served by the
+// admin listener instead.
+func NewProxyHTTPHandler(upstream http.Handler, limiter middleware.Limiter, opts []ratelimit.MiddlewareOption) http.Handler {
+	return ratelimit.Middleware(limiter, opts...)(upstream)
+}
+
+func withOperationalRoutes(api http.Handler, limiter middleware.Limiter, opts []ratelimit.MiddlewareOption, circuitState func() string, readiness ...handler.HealthCheck) http.Handler {
+	mux := newOperationalMux(limiter, opts, circuitState, readiness...)
+	mux.Handle("/", ratelimit.Middleware(limiter, opts...)(api))
+	return mux
+}
+
+// newOperationalMux serves the probes and the auth request endpoint.
+func newOperationalMux(limiter middleware.Limiter, opts []ratelimit.MiddlewareOption, circuitState func() string, readiness ...handler.HealthCheck) *http.ServeMux {
+	mux := newProbeMux(circuitState, readiness...)
+	mux.Handle("/authz", middleware.AuthRequestHandler(limiter, opts...))
+	mux.Handle("/authz/", middleware.AuthRequestHandler(limiter, opts...))
+	return mux
+}
+
+// newProbeMux serves the liveness, readiness and circuit breaker probes,
+// which never go through the limiter.
+func newProbeMux(circuitState func() string, readiness ...handler.HealthCheck) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/hello", handler.HelloWorldHandler)
-	return middleware.RateLimitMiddleware(mux, limiter)
+	mux.HandleFunc("/healthz", handler.LivenessHandler)
+	mux.Handle("/readyz", handler.ReadinessHandler(readiness...))
+	mux.Handle("/health/circuit-breaker", handler.CircuitBreakerHealthHandler(circuitState))
+	return mux
+}
+
+// NewAdminHTTPHandler serves the metrics and operator endpoints on the
+// internal listener, away from the rate-limited routes, in front of the
+// operational routes. The internal listener is plain HTTP, so probes reach
+// it even when the main one requires client certificates. Unlocking is only
+// exposed with a token.
+func NewAdminHTTPHandler(unlocker handler.Unlocker, token string, operational http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	if token != "" {
+		mux.Handle("DELETE /admin/lockouts/{account}", handler.UnlockHandler(unlocker, token))
+	}
+	mux.Handle("/", operational)
+	return mux
 }
 
 func Run(ctx context.Context, cfg config.Config) error {
-	tokenLimits := database.NewTokenLimitList(cfg.TokenLimits)
+	// Background work must outlive the signal so in-flight requests can still
+	// reach the store while the server drains; it is stopped explicitly below.
+	baseCtx := context.WithoutCancel(ctx)
+
+	upstream, err := newUpstreamProxy(cfg)
+	if err != nil {
+		return err
+	}
+
+	var grpcListener net.Listener
+	if cfg.GRPCAddr != "" {
+		grpcListener, err = net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("grpc listen: %w", err)
+		}
+		defer grpcListener.Close()
+	}
+
+	rules, err := loadPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	middlewareOpts := []ratelimit.MiddlewareOption{
+		ratelimit.WithRules(rules),
+		ratelimit.WithTrustedProxies(cfg.TrustedProxyPrefixes()...),
+	}
+	verifier, err := loadJWTVerifier(cfg.JWT)
+	if err != nil {
+		return err
+	}
+	if verifier != nil {
+		middlewareOpts = append(middlewareOpts, ratelimit.WithJWT(verifier, ratelimit.ClaimMapping{
+			Subject: cfg.JWT.SubjectClaim,
+			Tenant:  cfg.JWT.TenantClaim,
+			Tier:    cfg.JWT.TierClaim,
+		}))
+	}
 
-	redisClient, err := database.NewRedisClient(ctx, cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
+	var serverTLS *tls.Config
+	if cfg.TLS.Enabled() {
+		serverTLS, err = serverTLSConfig(cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("tls config error: %w", err)
+		}
+		if cfg.TLS.ClientAuth != config.ClientAuthNone {
+			field, err := policy.ParseCertField(cfg.TLS.ClientIdentity)
+			if err != nil {
+				return fmt.Errorf("tls config error: %w", err)
+			}
+			middlewareOpts = append(middlewareOpts, ratelimit.WithClientCert(field))
+		}
+	}
+
+	tokenLimits := database.NewTokenLimitList(cfg.TokenLimits)
+	tokenLimits.AddTiers(cfg.JWT.Tiers)
+	tokenLimits.Tenants, err = database.ParseTokenTenants(cfg.TokenTenants)
+	if err != nil {
+		return fmt.Errorf("token config error: %w", err)
+	}
+	store, err := newStateStore(baseCtx, cfg)
 	if err != nil {
-		return fmt.Errorf("redis client error: %w", err)
+		return err
 	}
 
-	repository := database.NewRedisRateLimitRepository(&redisClient)
-	limiter := usecase.NewIpRateLimiter(
-		ctx,
-		cfg.DefaultLimit,
-		cfg.CleanupInterval,
-		cfg.BlockDuration,
-		&tokenLimits,
-		repository,
+	limiter := ratelimit.New(
+		ratelimit.WithContext(baseCtx),
+		ratelimit.WithLimit(cfg.DefaultLimit),
+		ratelimit.WithWindow(cfg.CleanupInterval),
+		ratelimit.WithBlockDuration(cfg.BlockDuration),
+		ratelimit.WithEscalation(ratelimit.Escalation{
+			Multiplier: cfg.Escalation.Multiplier,
+			Max:        cfg.Escalation.Max,
+			Decay:      cfg.Escalation.Decay,
+		}),
+		ratelimit.WithTokenLimits(&tokenLimits),
+		ratelimit.WithStore(store.repository),
+		ratelimit.WithFailOpen(cfg.FailOpen),
+		ratelimit.WithConcurrencyLimit(cfg.Concurrency.Limit, cfg.Concurrency.Lease, store.concurrency),
+		ratelimit.WithPenaltyBox(cfg.Penalty.StatusCodes(), cfg.Penalty.Threshold, cfg.Penalty.Window, cfg.Penalty.Block, store.penalties),
+		ratelimit.WithLockoutStore(store.penalties),
+		ratelimit.WithWindowStore(store.quotas),
+		ratelimit.WithQuotas(rules.Location(), store.quotas, rules.Quotas...),
+		ratelimit.WithScopes(rules.Hierarchy()...),
 	)
 
-	handler := NewHTTPHandler(limiter)
+	readiness := readinessChecks(cfg, store)
+	httpHandler := NewHTTPHandler(limiter, middlewareOpts, store.circuitState, readiness...)
+	adminRoutes := http.Handler(newProbeMux(store.circuitState, readiness...))
+	switch {
+	case upstream != nil && cfg.AdminAddr != "":
+		httpHandler = NewProxyHTTPHandler(upstream, limiter, middlewareOpts)
+		adminRoutes = newOperationalMux(limiter, middlewareOpts, store.circuitState, readiness...)
+		log.Println("proxy mode enabled")
+	case upstream != nil:
+		httpHandler = withOperationalRoutes(upstream, limiter, middlewareOpts, store.circuitState, readiness...)
+		log.Println("proxy mode enabled; operational routes are answered locally without RATELIMIT_ADMIN_ADDR")
+	}
+
+	server := &http.Server{
+		Addr:      cfg.HTTPAddr,
+		Handler:   httpHandler,
+		TLSConfig: serverTLS,
+	}
 
+	serveErr := make(chan error, 3)
+	go func() {
+		if serverTLS != nil {
+			serveErr <- fmt.Errorf("server failed: %w", server.ListenAndServeTLS("", ""))
+			return
+		}
+		serveErr <- fmt.Errorf("server failed: %w", server.ListenAndServe())
+	}()
 	log.Printf("%s started", cfg.HTTPAddr)
-	if err := http.ListenAndServe(cfg.HTTPAddr, handler); err != nil {
-		return fmt.Errorf("server failed: %w", err)
+
+	if cfg.TLS.ClientAuth == config.ClientAuthRequire && cfg.AdminAddr == "" {
+		log.Println("client certificates required: probes without one need RATELIMIT_ADMIN_ADDR")
 	}
 
-	return nil
+	var adminServer *http.Server
+	if cfg.AdminAddr != "" {
+		adminServer = &http.Server{
+			Addr:    cfg.AdminAddr,
+			Handler: NewAdminHTTPHandler(limiter, cfg.AdminToken, adminRoutes),
+		}
+		go func() {
+			serveErr <- fmt.Errorf("admin server failed: %w", adminServer.ListenAndServe())
+		}()
+		log.Printf("admin %s started", cfg.AdminAddr)
+	}
+
+	var grpcServer *grpc.Server
+	if grpcListener != nil {
+		grpcServer = NewGRPCServer(cfg, limiter)
+		go func() {
+			serveErr <- fmt.Errorf("grpc server failed: %w", grpcServer.Serve(grpcListener))
+		}()
+		log.Printf("grpc %s started", cfg.GRPCAddr)
+	}
+
+	var runErr error
+	select {
+	case runErr = <-serveErr:
+	case <-ctx.Done():
+		log.Println("shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(baseCtx, cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && runErr == nil {
+		runErr = fmt.Errorf("server shutdown: %w", err)
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil && runErr == nil {
+			runErr = fmt.Errorf("admin server shutdown: %w", err)
+		}
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+
+	limiter.Close()
+
+	closeCtx, cancelClose := context.WithTimeout(baseCtx, cfg.ShutdownTimeout)
+	defer cancelClose()
+	if err := store.close(closeCtx); err != nil && runErr == nil {
+		runErr = fmt.Errorf("store close: %w", err)
+	}
+	return runErr
+}
+
+// newUpstreamProxy returns nil when no upstream is configured, in which case
+// the service only exposes its own example endpoint.
+func newUpstreamProxy(cfg config.Config) (http.Handler, error) {
+	if cfg.ProxyUpstream == "" && cfg.ProxyRoutes == "" {
+		return nil, nil
+	}
+
+	routes, err := proxy.ParseRoutes(cfg.ProxyRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("proxy config error: %w", err)
+	}
+
+	var fallback *url.URL
+	if cfg.ProxyUpstream != "" {
+		fallback, err = proxy.ParseUpstream(cfg.ProxyUpstream)
+		if err != nil {
+			return nil, fmt.Errorf("proxy config error: %w", err)
+		}
+	}
+	return proxy.New(routes, fallback), nil
+}
+
+// loadPolicy returns an empty policy, under which every request costs one
+// unit, when no policy file is configured.
+func loadPolicy(cfg config.Config) (policy.Policy, error) {
+	if cfg.PolicyFile == "" {
+		return policy.Policy{}, nil
+	}
+	rules, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		return policy.Policy{}, fmt.Errorf("policy config error: %w", err)
+	}
+	return rules, nil
+}
+
+// loadJWTVerifier returns nil, leaving bearer tokens unchecked, when no key
+// is configured.
+func loadJWTVerifier(cfg config.JWTConfig) (*jwt.Verifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	verifier := jwt.NewVerifier()
+	if cfg.Secret != "" {
+		verifier.AddSecret([]byte(cfg.Secret))
+	}
+	if cfg.PublicKeyFile != "" {
+		raw, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt config error: %w", err)
+		}
+		if err := verifier.AddPEM(raw); err != nil {
+			return nil, fmt.Errorf("jwt config error: %s: %w", cfg.PublicKeyFile, err)
+		}
+	}
+	if cfg.JWKSFile != "" {
+		raw, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt config error: %w", err)
+		}
+		if err := verifier.AddJWKS(raw); err != nil {
+			return nil, fmt.Errorf("jwt config error: %s: %w", cfg.JWKSFile, err)
+		}
+	}
+	return verifier, nil
+}
+
+func readinessChecks(cfg config.Config, store *stateStore) []handler.HealthCheck {
+	checks := []handler.HealthCheck{
+		{
+			Name: "config",
+			Check: func(ctx context.Context) error {
+				if cfg.DefaultLimit <= 0 {
+					return fmt.Errorf("default limit must be positive, got %d", cfg.DefaultLimit)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "circuit_breaker",
+			Check: func(ctx context.Context) error {
+				if state := store.circuitState(); state == string(database.CircuitOpen) {
+					return database.ErrCircuitOpen
+				}
+				return nil
+			},
+		},
+	}
+	if store.ping != nil {
+		checks = append(checks, handler.HealthCheck{Name: "redis", Check: store.ping})
+	}
+	return checks
 }
@@ -1,11 +1,19 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/config"
+	"github.com/xavierpms/rate-limiter/internal/web/handler"
+	"github.com/xavierpms/rate-limiter/pkg/ratelimit"
 )
 
 type fakeLimiter struct {
@@ -22,7 +30,7 @@ func (f *fakeLimiter) Allow(ip, token string) bool {
 
 func TestNewHTTPHandler_Returns200WhenLimiterAllows(t *testing.T) {
 	limiter := &fakeLimiter{allow: true}
-	handler := NewHTTPHandler(limiter)
+	handler := NewHTTPHandler(limiter, nil, func() string { return "closed" })
 
 	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
 	req.RemoteAddr = "127.0.0.1:12345"
@@ -55,7 +63,7 @@ func TestNewHTTPHandler_Returns200WhenLimiterAllows(t *testing.T) {
 
 func TestNewHTTPHandler_Returns429WhenLimiterBlocks(t *testing.T) {
 	limiter := &fakeLimiter{allow: false}
-	handler := NewHTTPHandler(limiter)
+	handler := NewHTTPHandler(limiter, nil, func() string { return "closed" })
 
 	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
 	req.RemoteAddr = "127.0.0.1:12345"
@@ -67,3 +75,267 @@ func TestNewHTTPHandler_Returns429WhenLimiterBlocks(t *testing.T) {
 		t.Fatalf("expected status 429, got %d", rec.Code)
 	}
 }
+
+func TestNewHTTPHandler_ExposesCircuitBreakerOutsideLimiter(t *testing.T) {
+	limiter := &fakeLimiter{allow: false}
+	handler := NewHTTPHandler(limiter, nil, func() string { return "open" })
+
+	req := httptest.NewRequest(http.MethodGet, "/health/circuit-breaker", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rec.Code)
+	}
+
+	if limiter.receivedIP != "" {
+		t.Fatal("expected health endpoint to bypass the limiter")
+	}
+}
+
+func TestNewHTTPHandler_ProbesBypassLimiter(t *testing.T) {
+	limiter := &fakeLimiter{allow: false}
+	failing := handler.HealthCheck{Name: "redis", Check: func(ctx context.Context) error { return errors.New("connection refused") }}
+	httpHandler := NewHTTPHandler(limiter, nil, func() string { return "closed" }, failing)
+
+	cases := map[string]int{
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusServiceUnavailable,
+	}
+	for path, status := range cases {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		rec := httptest.NewRecorder()
+
+		httpHandler.ServeHTTP(rec, req)
+
+		if rec.Code != status {
+			t.Fatalf("expected status %d for %s, got %d", status, path, rec.Code)
+		}
+	}
+
+	if limiter.receivedIP != "" {
+		t.Fatal("expected probes to bypass the limiter")
+	}
+}
+
+func TestReadinessChecks_ReportOpenCircuit(t *testing.T) {
+	store := &stateStore{circuitState: func() string { return "open" }}
+	checks := readinessChecks(config.Config{DefaultLimit: 10}, store)
+
+	results := make(map[string]error)
+	for _, check := range checks {
+		results[check.Name] = check.Check(context.Background())
+	}
+
+	if results["config"] != nil {
+		t.Fatalf("expected config check to pass, got %v", results["config"])
+	}
+
+	if results["circuit_breaker"] == nil {
+		t.Fatal("expected circuit breaker check to fail when open")
+	}
+
+	if _, ok := results["redis"]; ok {
+		t.Fatal("expected no redis check without a ping function")
+	}
+}
+
+func TestNewProxyHTTPHandler_ForwardsAllowedRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "legacy "+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	upstream, err := newUpstreamProxy(config.Config{ProxyUpstream: backend.URL})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	limiter := &fakeLimiter{allow: true}
+	httpHandler := NewProxyHTTPHandler(upstream, limiter, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	httpHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "legacy /orders/42" {
+		t.Fatalf("expected request to be proxied, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	limiter.allow = false
+	rec = httptest.NewRecorder()
+	httpHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+
+	limiter.allow = true
+	for _, path := range []string{"/healthz", "/readyz", "/authz/orders", "/health/circuit-breaker"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		rec := httptest.NewRecorder()
+		httpHandler.ServeHTTP(rec, req)
+		if rec.Body.String() != "legacy "+path {
+			t.Fatalf("expected %s to reach the upstream, got %d %q", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	admin := NewAdminHTTPHandler(&fakeUnlocker{}, "", newOperationalMux(limiter, nil, func() string { return "closed" }))
+	for _, path := range []string{"/healthz", "/readyz", "/authz/orders", "/health/circuit-breaker"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected %s to be served by the admin listener, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestNewUpstreamProxy(t *testing.T) {
+	upstream, err := newUpstreamProxy(config.Config{})
+	if err != nil || upstream != nil {
+		t.Fatalf("expected proxy mode to be disabled, got %v, %v", upstream, err)
+	}
+
+	if _, err := newUpstreamProxy(config.Config{ProxyRoutes: "/reports"}); err == nil {
+		t.Fatal("expected error for invalid route")
+	}
+
+	if _, err := newUpstreamProxy(config.Config{ProxyUpstream: "legacy:8080"}); err == nil {
+		t.Fatal("expected error for upstream without scheme")
+	}
+}
+
+func TestNewHTTPHandler_AuthRequestEndpoint(t *testing.T) {
+	limiter := &fakeLimiter{allow: false}
+	opts := []ratelimit.MiddlewareOption{ratelimit.WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/8"))}
+	httpHandler := NewHTTPHandler(limiter, opts, func() string { return "closed" })
+
+	for _, path := range []string{"/authz", "/authz/orders/1"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.2:8000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		rec := httptest.NewRecorder()
+
+		httpHandler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status 429 for %s, got %d", path, rec.Code)
+		}
+
+		if limiter.receivedIP != "203.0.113.9" {
+			t.Fatalf("expected forwarded client ip, got %q", limiter.receivedIP)
+		}
+	}
+}
+
+func TestRun_ShutsDownGracefullyOnContextCancel(t *testing.T) {
+	cfg := config.Config{
+		HTTPAddr:        "127.0.0.1:0",
+		ShutdownTimeout: time.Second,
+		DefaultLimit:    10,
+		CleanupInterval: time.Hour,
+		BlockDuration:   time.Second,
+		Store:           config.StoreMemory,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, cfg)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected clean shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Run to return after context cancellation")
+	}
+}
+
+type fakeUnlocker struct {
+	account string
+}
+
+func (f *fakeUnlocker) Unlock(account string) error {
+	f.account = account
+	return nil
+}
+
+func TestNewAdminHTTPHandler_UnlocksAccounts(t *testing.T) {
+	unlocker := &fakeUnlocker{}
+	adminHandler := NewAdminHTTPHandler(unlocker, "secret", http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/lockouts/alice", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	adminHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || unlocker.account != "alice" {
+		t.Fatalf("expected alice to be unlocked, got %d %q", rec.Code, unlocker.account)
+	}
+
+	rec = httptest.NewRecorder()
+	NewAdminHTTPHandler(unlocker, "", http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/lockouts/alice", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unlocking to be disabled without a token, got %d", rec.Code)
+	}
+}
+
+func TestNewHTTPHandler_DoesNotServeAdminRoutes(t *testing.T) {
+	limiter := &fakeLimiter{allow: true}
+	httpHandler := NewHTTPHandler(limiter, nil, func() string { return "closed" })
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/lockouts/alice", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	httpHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected admin routes to be absent from the public listener, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec = httptest.NewRecorder()
+	httpHandler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected metrics to be absent from the public listener, got %d", rec.Code)
+	}
+}
+
+func TestNewAdminHTTPHandler_ServesMetrics(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewAdminHTTPHandler(&fakeUnlocker{}, "", http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "memstats") {
+		t.Fatalf("expected expvar metrics, got %d", rec.Code)
+	}
+}
+
+func TestLoadJWTVerifier(t *testing.T) {
+	verifier, err := loadJWTVerifier(config.JWTConfig{})
+	if err != nil || verifier != nil {
+		t.Fatalf("expected verification to be disabled, got %v, %v", verifier, err)
+	}
+
+	verifier, err = loadJWTVerifier(config.JWTConfig{Secret: "secret"})
+	if err != nil || verifier == nil {
+		t.Fatalf("expected a verifier, got %v, %v", verifier, err)
+	}
+
+	if _, err := loadJWTVerifier(config.JWTConfig{JWKSFile: "/nonexistent/jwks.json"}); err == nil {
+		t.Fatal("expected error for missing JWKS file")
+	}
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/config"
+	"github.com/xavierpms/rate-limiter/internal/database"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+var circuitBreakerMetrics = expvar.NewMap("ratelimit_circuit_breaker")
+
+type stateStore struct {
+	repository   ports.RateLimitStateRepository
+	concurrency  ports.ConcurrencyRepository
+	quotas       ports.QuotaRepository
+	penalties    ports.PenaltyRepository
+	circuitState func() string
+	ping         func(ctx context.Context) error
+	close        func(ctx context.Context) error
+}
+
+func newStateStore(ctx context.Context, cfg config.Config) (*stateStore, error) {
+	if cfg.Store == config.StoreMemory {
+		recordCircuitState(database.CircuitClosed)
+		return &stateStore{
+			repository:   database.NewMemoryRateLimitRepository(cfg.Memory.Shards, cfg.Memory.MaxKeys, cfg.Memory.TTL),
+			concurrency:  database.NewMemoryConcurrencyRepository(),
+			quotas:       database.NewMemoryQuotaRepository(cfg.Memory.MaxKeys),
+			penalties:    database.NewMemoryPenaltyRepository(cfg.Memory.MaxKeys),
+			circuitState: func() string { return string(database.CircuitClosed) },
+			close:        func(ctx context.Context) error { return nil },
+		}, nil
+	}
+
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	redisClient, err := database.NewUniversalRedisClient(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("redis client error: %w", err)
+	}
+
+	if cfg.MigrateKeys {
+		moved, err := database.NewRedisRateLimitRepository(&redisClient).MigrateLegacyKeys(ctx)
+		if err != nil {
+			redisClient.Close()
+			return nil, fmt.Errorf("redis key migration error: %w", err)
+		}
+		log.Printf("migrated %d legacy rate-limit keys", moved)
+	}
+
+	breaker := database.NewCircuitBreaker(database.CircuitBreakerConfig{
+		FailureThreshold:  cfg.CircuitBreaker.FailureThreshold,
+		OpenTimeout:       cfg.CircuitBreaker.OpenTimeout,
+		HalfOpenSuccesses: cfg.CircuitBreaker.HalfOpenSuccesses,
+		OnStateChange:     recordCircuitTransition,
+	})
+	recordCircuitState(breaker.State())
+
+	// The breaker guards the Redis calls themselves, so in hybrid mode the
+	// syncs count towards it and local hits do not hide an unreachable Redis.
+	var repository ports.RateLimitStateRepository = breaker.Repository(database.NewRedisRateLimitRepository(&redisClient))
+	var hybrid *database.HybridRateLimitRepository
+	if cfg.Store == config.StoreHybrid {
+		hybrid = database.NewHybridRateLimitRepository(ctx, breaker.Counter(database.NewRedisRateLimitRepository(&redisClient)), cfg.Hybrid.SyncInterval, cfg.Hybrid.MaxOvershoot)
+		repository = hybrid
+	}
+	return &stateStore{
+		repository:   repository,
+		concurrency:  breaker.Concurrency(database.NewRedisConcurrencyRepository(&redisClient)),
+		quotas:       breaker.Quotas(database.NewRedisQuotaRepository(&redisClient)),
+		penalties:    breaker.Penalties(database.NewRedisPenaltyRepository(&redisClient)),
+		circuitState: func() string { return string(breaker.State()) },
+		ping: func(ctx context.Context) error {
+			return redisClient.Client.Ping(ctx).Err()
+		},
+		close: func(ctx context.Context) error {
+			if hybrid != nil {
+				hybrid.Close(ctx)
+			}
+			return redisClient.Close()
+		},
+	}, nil
+}
+
+func redisOptions(cfg config.Config) (database.RedisOptions, error) {
+	addrs := make([]string, 0)
+	for _, addr := range strings.Split(cfg.RedisAddr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	opts := database.RedisOptions{
+		Mode:             cfg.RedisMode,
+		Addrs:            addrs,
+		MasterName:       cfg.RedisSentinel.MasterName,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		SentinelPassword: cfg.RedisSentinel.Password,
+		DB:               cfg.RedisDB,
+	}
+	if cfg.RedisTLS.Enabled {
+		tlsConfig, err := redisTLSConfig(cfg.RedisTLS)
+		if err != nil {
+			return database.RedisOptions{}, fmt.Errorf("redis tls error: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+func redisTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// serverTLSConfig loads the certificate the server presents and, when client
+// certificates are verified, the CA bundle they must chain to.
+func serverTLSConfig(cfg config.ServerTLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	switch cfg.ClientAuth {
+	case config.ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return tlsConfig, nil
+	}
+	pool, err := loadCertPool(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func recordCircuitTransition(from, to database.CircuitState) {
+	log.Printf("circuit breaker %s -> %s", from, to)
+	circuitBreakerMetrics.Add("transitions", 1)
+	recordCircuitState(to)
+}
+
+func recordCircuitState(state database.CircuitState) {
+	value := new(expvar.String)
+	value.Set(string(state))
+	circuitBreakerMetrics.Set("state", value)
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/config"
+	"github.com/xavierpms/rate-limiter/internal/database"
+	"github.com/xavierpms/rate-limiter/pkg/ratelimit"
+)
+
+func TestNewStateStore_MemoryStore(t *testing.T) {
+	cfg := config.Config{
+		Store:  config.StoreMemory,
+		Memory: config.MemoryStoreConfig{Shards: 2, MaxKeys: 10},
+	}
+
+	store, err := newStateStore(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, ok := store.repository.(*database.MemoryRateLimitRepository); !ok {
+		t.Fatalf("expected memory repository, got %T", store.repository)
+	}
+
+	if store.circuitState() != "closed" {
+		t.Fatalf("expected closed circuit for memory store, got %s", store.circuitState())
+	}
+
+	if err := store.close(context.Background()); err != nil {
+		t.Fatalf("expected close to succeed, got %v", err)
+	}
+}
+
+func TestRedisOptions_SplitsAddressesAndEnablesTLS(t *testing.T) {
+	cfg := config.Config{
+		RedisAddr:     "sentinel-1:26379, sentinel-2:26379,",
+		RedisMode:     config.RedisModeSentinel,
+		RedisSentinel: config.RedisSentinelConfig{MasterName: "mymaster"},
+		RedisTLS:      config.RedisTLSConfig{Enabled: true},
+	}
+
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(opts.Addrs) != 2 || opts.Addrs[0] != "sentinel-1:26379" || opts.Addrs[1] != "sentinel-2:26379" {
+		t.Fatalf("unexpected addresses: %v", opts.Addrs)
+	}
+
+	if opts.Mode != database.RedisModeSentinel || opts.MasterName != "mymaster" {
+		t.Fatalf("unexpected sentinel options: %#v", opts)
+	}
+
+	if opts.TLSConfig == nil {
+		t.Fatal("expected TLS config to be set")
+	}
+}
+
+func TestRedisOptions_LoadsTLSFiles(t *testing.T) {
+	caFile := writeTestCA(t).certFile
+	cfg := config.Config{
+		RedisAddr:     "redis.example.com:6380",
+		RedisUsername: "limiter",
+		RedisPassword: "secret",
+		RedisTLS: config.RedisTLSConfig{
+			Enabled:    true,
+			CAFile:     caFile,
+			ServerName: "redis.internal",
+		},
+	}
+
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if opts.Username != "limiter" || opts.Password != "secret" {
+		t.Fatalf("unexpected credentials: %q/%q", opts.Username, opts.Password)
+	}
+
+	if opts.TLSConfig.RootCAs == nil || opts.TLSConfig.ServerName != "redis.internal" {
+		t.Fatalf("unexpected tls config: %#v", opts.TLSConfig)
+	}
+
+	cfg.RedisTLS.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := redisOptions(cfg); err == nil {
+		t.Fatal("expected error for missing CA bundle")
+	}
+}
+
+func writeTestCA(t *testing.T) testCertificate {
+	t.Helper()
+
+	return writeTestCertificate(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	})
+}
+
+func TestServerTLSConfig_IdentifiesClientCertificates(t *testing.T) {
+	ca := writeTestCA(t)
+	server := writeTestCertificate(t, &ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	partner := writeTestCertificate(t, &ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "partner-a"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	cfg := config.ServerTLSConfig{
+		CertFile:     server.certFile,
+		KeyFile:      server.keyFile,
+		ClientCAFile: ca.certFile,
+		ClientAuth:   config.ClientAuthRequire,
+	}
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	limiter := &fakeLimiter{allow: true}
+	srv := httptest.NewUnstartedServer(NewHTTPHandler(limiter, []ratelimit.MiddlewareOption{ratelimit.WithClientCert(ratelimit.CertSubject)}, func() string { return "closed" }))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	resp, err := client(tls.Certificate{Certificate: [][]byte{partner.cert.Raw}, PrivateKey: partner.key}).Get(srv.URL + "/hello")
+	if err != nil {
+		t.Fatalf("expected request to succeed, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || limiter.receivedIP != "cert:subject=partner-a" || limiter.receivedTK != "partner-a" {
+		t.Fatalf("expected partner to be identified by its certificate, got %d %q %q", resp.StatusCode, limiter.receivedIP, limiter.receivedTK)
+	}
+
+	if resp, err := client().Get(srv.URL + "/hello"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected request without a client certificate to be rejected")
+	}
+
+	cfg.ClientCAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := serverTLSConfig(cfg); err == nil {
+		t.Fatal("expected error for missing CA bundle")
+	}
+}
+
+func TestServerTLSConfig_ProbesReachAdminListenerWithoutCertificate(t *testing.T) {
+	ca := writeTestCA(t)
+	server := writeTestCertificate(t, &ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	tlsConfig, err := serverTLSConfig(config.ServerTLSConfig{
+		CertFile:     server.certFile,
+		KeyFile:      server.keyFile,
+		ClientCAFile: ca.certFile,
+		ClientAuth:   config.ClientAuthRequire,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	limiter := &fakeLimiter{allow: true}
+	circuitState := func() string { return "closed" }
+	main := httptest.NewUnstartedServer(NewHTTPHandler(limiter, nil, circuitState))
+	main.TLS = tlsConfig
+	main.StartTLS()
+	defer main.Close()
+	admin := httptest.NewServer(NewAdminHTTPHandler(&fakeUnlocker{}, "", newProbeMux(circuitState)))
+	defer admin.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	probe := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if resp, err := probe.Get(main.URL + "/healthz"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the main listener to reject a probe without a client certificate")
+	}
+
+	for _, path := range []string{"/healthz", "/readyz", "/health/circuit-breaker"} {
+		resp, err := probe.Get(admin.URL + path)
+		if err != nil {
+			t.Fatalf("%s: expected the admin listener to answer, got %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+// testCertificate is a certificate issued for a test, written with its key
+// to PEM files.
+type testCertificate struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// writeTestCertificate issues template, signed by issuer or self-signed when
+// issuer is nil.
+func writeTestCertificate(t *testing.T, issuer *testCertificate, template *x509.Certificate) testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, parentKey := template, key
+	if issuer != nil {
+		parent, parentKey = issuer.cert, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	written := testCertificate{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+	if err := os.WriteFile(written.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(written.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return written
+}
@@ -2,20 +2,141 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	StoreRedis  = "redis"
+	StoreMemory = "memory"
+	StoreHybrid = "hybrid"
+
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
 type Config struct {
 	HTTPAddr        string
+	GRPCAddr        string
+	AdminAddr       string
+	ShutdownTimeout time.Duration
 	DefaultLimit    int
 	CleanupInterval time.Duration
 	BlockDuration   time.Duration
 	TokenLimits     string
+	TokenTenants    string
+	ProxyUpstream   string
+	ProxyRoutes     string
+	PolicyFile      string
+	AdminToken      string
+	TrustedProxies  string
+	Store           string
+	Memory          MemoryStoreConfig
+	Hybrid          HybridStoreConfig
 	RedisAddr       string
 	RedisPassword   string
 	RedisDB         int
+	RedisMode       string
+	RedisSentinel   RedisSentinelConfig
+	RedisUsername   string
+	RedisTLS        RedisTLSConfig
+	MigrateKeys     bool
+	FailOpen        bool
+	CircuitBreaker  CircuitBreakerConfig
+	Concurrency     ConcurrencyConfig
+	Escalation      EscalationConfig
+	Penalty         PenaltyConfig
+	JWT             JWTConfig
+	TLS             ServerTLSConfig
+}
+
+type RedisSentinelConfig struct {
+	MasterName string
+	Password   string
+}
+
+type RedisTLSConfig struct {
+	Enabled    bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+type MemoryStoreConfig struct {
+	Shards  int
+	MaxKeys int
+	TTL     time.Duration
+}
+
+type HybridStoreConfig struct {
+	SyncInterval time.Duration
+	MaxOvershoot int
+}
+
+type ConcurrencyConfig struct {
+	Limit int
+	Lease time.Duration
+}
+
+// EscalationConfig multiplies RATELIMIT_BLOCK_TIME for keys blocked again
+// before Decay has passed since their last block ended, up to Max.
+type EscalationConfig struct {
+	Multiplier int
+	Max        time.Duration
+	Decay      time.Duration
+}
+
+// PenaltyConfig blocks keys for Block once Threshold of their responses
+// within Window had one of Statuses, a comma separated list of HTTP status
+// codes. A zero Threshold disables it.
+type PenaltyConfig struct {
+	Statuses  string
+	Threshold int
+	Window    time.Duration
+	Block     time.Duration
+}
+
+// JWTConfig holds the keys bearer tokens are verified against, an HS256
+// Secret, a PEM PublicKeyFile and a JWKS file, the claims mapped to the
+// rate-limit identity and the limits of each tier. Verification is off when
+// no key is set.
+type JWTConfig struct {
+	Secret        string
+	PublicKeyFile string
+	JWKSFile      string
+	SubjectClaim  string
+	TenantClaim   string
+	TierClaim     string
+	Tiers         string
+}
+
+// ServerTLSConfig serves HTTPS with CertFile and KeyFile. With ClientAuth
+// "optional" or "require", client certificates are verified against
+// ClientCAFile and ClientIdentity ("subject", "san" or "fingerprint") names
+// the part identifying the client.
+type ServerTLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientAuth     string
+	ClientIdentity string
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold  int
+	OpenTimeout       time.Duration
+	HalfOpenSuccesses int
 }
 
 func LoadFromEnv() (Config, error) {
@@ -34,18 +155,181 @@ func LoadFromEnv() (Config, error) {
 		return Config{}, err
 	}
 
-	redisAddr, err := requiredString("RATELIMIT_REDIS_URL")
+	store := os.Getenv("RATELIMIT_STORE")
+	if store == "" {
+		store = StoreRedis
+	}
+	if store != StoreRedis && store != StoreMemory && store != StoreHybrid {
+		return Config{}, fmt.Errorf("invalid RATELIMIT_STORE: %q", store)
+	}
+
+	redisAddr := os.Getenv("RATELIMIT_REDIS_URL")
+	if store != StoreMemory {
+		redisAddr, err = requiredString("RATELIMIT_REDIS_URL")
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	redisMode := os.Getenv("RATELIMIT_REDIS_MODE")
+	if redisMode == "" {
+		redisMode = RedisModeSingle
+	}
+	if redisMode != RedisModeSingle && redisMode != RedisModeSentinel && redisMode != RedisModeCluster {
+		return Config{}, fmt.Errorf("invalid RATELIMIT_REDIS_MODE: %q", redisMode)
+	}
+
+	sentinelMaster := os.Getenv("RATELIMIT_REDIS_SENTINEL_MASTER")
+	if redisMode == RedisModeSentinel && store != StoreMemory {
+		sentinelMaster, err = requiredString("RATELIMIT_REDIS_SENTINEL_MASTER")
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	redisTLS, err := loadRedisTLS()
+	if err != nil {
+		return Config{}, err
+	}
+
+	serverTLS, err := loadServerTLS()
+	if err != nil {
+		return Config{}, err
+	}
+
+	memoryShards, err := optionalInt("RATELIMIT_MEMORY_SHARDS", 32)
+	if err != nil {
+		return Config{}, err
+	}
+
+	memoryMaxKeys, err := optionalInt("RATELIMIT_MEMORY_MAX_KEYS", 100000)
+	if err != nil {
+		return Config{}, err
+	}
+
+	memoryTTLMs, err := optionalInt("RATELIMIT_MEMORY_TTL", 0)
+	if err != nil {
+		return Config{}, err
+	}
+
+	shutdownMs, err := optionalInt("RATELIMIT_SHUTDOWN_TIMEOUT", 10000)
 	if err != nil {
 		return Config{}, err
 	}
 
-	redisDB := 0
-	if rawDB := os.Getenv("RATELIMIT_REDIS_DB"); rawDB != "" {
-		parsedDB, parseErr := strconv.Atoi(rawDB)
+	redisDB, err := optionalInt("RATELIMIT_REDIS_DB", 0)
+	if err != nil {
+		return Config{}, err
+	}
+
+	redisUsername := os.Getenv("RATELIMIT_REDIS_USERNAME")
+	redisPassword := os.Getenv("RATELIMIT_REDIS_PASSWORD")
+	if strings.Contains(redisAddr, "://") {
+		parsed, parseErr := parseRedisURL(redisAddr)
 		if parseErr != nil {
-			return Config{}, fmt.Errorf("invalid RATELIMIT_REDIS_DB: %w", parseErr)
+			return Config{}, parseErr
+		}
+		redisAddr = parsed.addr
+		if redisUsername == "" {
+			redisUsername = parsed.username
+		}
+		if redisPassword == "" {
+			redisPassword = parsed.password
 		}
-		redisDB = parsedDB
+		if os.Getenv("RATELIMIT_REDIS_DB") == "" && parsed.db >= 0 {
+			redisDB = parsed.db
+		}
+		if parsed.tls {
+			redisTLS.Enabled = true
+		}
+	}
+
+	hybridSyncMs, err := optionalInt("RATELIMIT_HYBRID_SYNC_INTERVAL", 100)
+	if err != nil {
+		return Config{}, err
+	}
+
+	hybridMaxOvershoot, err := optionalInt("RATELIMIT_HYBRID_MAX_OVERSHOOT", 10)
+	if err != nil {
+		return Config{}, err
+	}
+
+	migrateKeys, err := optionalBool("RATELIMIT_REDIS_MIGRATE_KEYS", false)
+	if err != nil {
+		return Config{}, err
+	}
+
+	failOpen, err := optionalBool("RATELIMIT_FAIL_OPEN", false)
+	if err != nil {
+		return Config{}, err
+	}
+
+	failureThreshold, err := optionalInt("RATELIMIT_CIRCUIT_FAILURE_THRESHOLD", 5)
+	if err != nil {
+		return Config{}, err
+	}
+
+	openTimeoutMs, err := optionalInt("RATELIMIT_CIRCUIT_OPEN_TIMEOUT", 5000)
+	if err != nil {
+		return Config{}, err
+	}
+
+	halfOpenSuccesses, err := optionalInt("RATELIMIT_CIRCUIT_HALF_OPEN_SUCCESSES", 1)
+	if err != nil {
+		return Config{}, err
+	}
+
+	concurrencyLimit, err := optionalInt("RATELIMIT_CONCURRENCY", 0)
+	if err != nil {
+		return Config{}, err
+	}
+
+	concurrencyLeaseMs, err := optionalInt("RATELIMIT_CONCURRENCY_LEASE", 60000)
+	if err != nil {
+		return Config{}, err
+	}
+
+	blockMultiplier, err := optionalInt("RATELIMIT_BLOCK_MULTIPLIER", 1)
+	if err != nil {
+		return Config{}, err
+	}
+
+	blockMaxMs, err := optionalInt("RATELIMIT_BLOCK_MAX_TIME", 3600000)
+	if err != nil {
+		return Config{}, err
+	}
+
+	blockDecayMs, err := optionalInt("RATELIMIT_BLOCK_DECAY", 3600000)
+	if err != nil {
+		return Config{}, err
+	}
+
+	penaltyStatuses := os.Getenv("RATELIMIT_PENALTY_STATUSES")
+	if penaltyStatuses == "" {
+		penaltyStatuses = "401,403,404"
+	}
+	if _, err := parseIntList(penaltyStatuses); err != nil {
+		return Config{}, fmt.Errorf("invalid RATELIMIT_PENALTY_STATUSES: %w", err)
+	}
+
+	trustedProxies := os.Getenv("RATELIMIT_TRUSTED_PROXIES")
+	if _, err := parsePrefixList(trustedProxies); err != nil {
+		return Config{}, fmt.Errorf("invalid RATELIMIT_TRUSTED_PROXIES: %w", err)
+	}
+
+	penaltyThreshold, err := optionalInt("RATELIMIT_PENALTY_THRESHOLD", 0)
+	if err != nil {
+		return Config{}, err
+	}
+
+	penaltyWindowMs, err := optionalInt("RATELIMIT_PENALTY_WINDOW", 60000)
+	if err != nil {
+		return Config{}, err
+	}
+
+	penaltyBlockMs, err := optionalInt("RATELIMIT_PENALTY_BLOCK_TIME", 600000)
+	if err != nil {
+		return Config{}, err
 	}
 
 	httpAddr := os.Getenv("RATELIMIT_HTTP_ADDR")
@@ -55,13 +339,63 @@ func LoadFromEnv() (Config, error) {
 
 	return Config{
 		HTTPAddr:        httpAddr,
+		GRPCAddr:        os.Getenv("RATELIMIT_GRPC_ADDR"),
+		AdminAddr:       os.Getenv("RATELIMIT_ADMIN_ADDR"),
+		ShutdownTimeout: time.Millisecond * time.Duration(shutdownMs),
 		DefaultLimit:    defaultLimit,
 		CleanupInterval: time.Millisecond * time.Duration(cleanupMs),
 		BlockDuration:   time.Millisecond * time.Duration(blockMs),
 		TokenLimits:     os.Getenv("RATELIMIT_TOKEN_LIST"),
-		RedisAddr:       redisAddr,
-		RedisPassword:   os.Getenv("RATELIMIT_REDIS_PASSWORD"),
-		RedisDB:         redisDB,
+		TokenTenants:    os.Getenv("RATELIMIT_TOKEN_TENANTS"),
+		ProxyUpstream:   os.Getenv("RATELIMIT_PROXY_UPSTREAM"),
+		ProxyRoutes:     os.Getenv("RATELIMIT_PROXY_ROUTES"),
+		PolicyFile:      os.Getenv("RATELIMIT_POLICY_FILE"),
+		AdminToken:      os.Getenv("RATELIMIT_ADMIN_TOKEN"),
+		TrustedProxies:  trustedProxies,
+		Store:           store,
+		Memory: MemoryStoreConfig{
+			Shards:  memoryShards,
+			MaxKeys: memoryMaxKeys,
+			TTL:     time.Millisecond * time.Duration(memoryTTLMs),
+		},
+		Hybrid: HybridStoreConfig{
+			SyncInterval: time.Millisecond * time.Duration(hybridSyncMs),
+			MaxOvershoot: hybridMaxOvershoot,
+		},
+		RedisAddr:     redisAddr,
+		RedisPassword: redisPassword,
+		RedisDB:       redisDB,
+		RedisMode:     redisMode,
+		RedisSentinel: RedisSentinelConfig{
+			MasterName: sentinelMaster,
+			Password:   os.Getenv("RATELIMIT_REDIS_SENTINEL_PASSWORD"),
+		},
+		RedisUsername: redisUsername,
+		RedisTLS:      redisTLS,
+		MigrateKeys:   migrateKeys,
+		FailOpen:      failOpen,
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold:  failureThreshold,
+			OpenTimeout:       time.Millisecond * time.Duration(openTimeoutMs),
+			HalfOpenSuccesses: halfOpenSuccesses,
+		},
+		Concurrency: ConcurrencyConfig{
+			Limit: concurrencyLimit,
+			Lease: time.Millisecond * time.Duration(concurrencyLeaseMs),
+		},
+		Escalation: EscalationConfig{
+			Multiplier: blockMultiplier,
+			Max:        time.Millisecond * time.Duration(blockMaxMs),
+			Decay:      time.Millisecond * time.Duration(blockDecayMs),
+		},
+		Penalty: PenaltyConfig{
+			Statuses:  penaltyStatuses,
+			Threshold: penaltyThreshold,
+			Window:    time.Millisecond * time.Duration(penaltyWindowMs),
+			Block:     time.Millisecond * time.Duration(penaltyBlockMs),
+		},
+		JWT: loadJWT(),
+		TLS: serverTLS,
 	}, nil
 }
 
@@ -79,6 +413,205 @@ func requiredInt(name string) (int, error) {
 	return value, nil
 }
 
+type redisURL struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      bool
+}
+
+// parseRedisURL accepts redis://[user[:password]@]host[:port][/db] and its
+// TLS variant rediss://. A missing database is reported as -1.
+func parseRedisURL(raw string) (redisURL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redisURL{}, fmt.Errorf("invalid RATELIMIT_REDIS_URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return redisURL{}, fmt.Errorf("invalid RATELIMIT_REDIS_URL: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return redisURL{}, fmt.Errorf("invalid RATELIMIT_REDIS_URL: missing host")
+	}
+
+	parsed := redisURL{addr: u.Host, db: -1, tls: u.Scheme == "rediss"}
+	if u.Port() == "" && !strings.Contains(u.Host, ",") {
+		parsed.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		parsed.username = u.User.Username()
+		parsed.password, _ = u.User.Password()
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		db, err := strconv.Atoi(path)
+		if err != nil {
+			return redisURL{}, fmt.Errorf("invalid RATELIMIT_REDIS_URL: invalid database %q", path)
+		}
+		parsed.db = db
+	}
+	return parsed, nil
+}
+
+func loadRedisTLS() (RedisTLSConfig, error) {
+	enabled, err := optionalBool("RATELIMIT_REDIS_TLS", false)
+	if err != nil {
+		return RedisTLSConfig{}, err
+	}
+
+	tlsConfig := RedisTLSConfig{
+		Enabled:    enabled,
+		CAFile:     os.Getenv("RATELIMIT_REDIS_TLS_CA_FILE"),
+		CertFile:   os.Getenv("RATELIMIT_REDIS_TLS_CERT_FILE"),
+		KeyFile:    os.Getenv("RATELIMIT_REDIS_TLS_KEY_FILE"),
+		ServerName: os.Getenv("RATELIMIT_REDIS_TLS_SERVER_NAME"),
+	}
+	if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		return RedisTLSConfig{}, fmt.Errorf("RATELIMIT_REDIS_TLS_CERT_FILE and RATELIMIT_REDIS_TLS_KEY_FILE must be set together")
+	}
+	if tlsConfig.CAFile != "" || tlsConfig.CertFile != "" || tlsConfig.ServerName != "" {
+		tlsConfig.Enabled = true
+	}
+	return tlsConfig, nil
+}
+
+func loadServerTLS() (ServerTLSConfig, error) {
+	tlsConfig := ServerTLSConfig{
+		CertFile:       os.Getenv("RATELIMIT_TLS_CERT_FILE"),
+		KeyFile:        os.Getenv("RATELIMIT_TLS_KEY_FILE"),
+		ClientCAFile:   os.Getenv("RATELIMIT_TLS_CLIENT_CA_FILE"),
+		ClientAuth:     os.Getenv("RATELIMIT_TLS_CLIENT_AUTH"),
+		ClientIdentity: optionalString("RATELIMIT_TLS_CLIENT_IDENTITY", "subject"),
+	}
+	if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		return ServerTLSConfig{}, fmt.Errorf("RATELIMIT_TLS_CERT_FILE and RATELIMIT_TLS_KEY_FILE must be set together")
+	}
+	if tlsConfig.ClientAuth == "" {
+		tlsConfig.ClientAuth = ClientAuthNone
+		if tlsConfig.ClientCAFile != "" {
+			tlsConfig.ClientAuth = ClientAuthOptional
+		}
+	}
+	switch tlsConfig.ClientAuth {
+	case ClientAuthNone, ClientAuthOptional, ClientAuthRequire:
+	default:
+		return ServerTLSConfig{}, fmt.Errorf("invalid RATELIMIT_TLS_CLIENT_AUTH: %q", tlsConfig.ClientAuth)
+	}
+	switch tlsConfig.ClientIdentity {
+	case "subject", "san", "fingerprint":
+	default:
+		return ServerTLSConfig{}, fmt.Errorf("invalid RATELIMIT_TLS_CLIENT_IDENTITY: %q", tlsConfig.ClientIdentity)
+	}
+	if tlsConfig.ClientAuth != ClientAuthNone && (tlsConfig.CertFile == "" || tlsConfig.ClientCAFile == "") {
+		return ServerTLSConfig{}, fmt.Errorf("client certificate verification requires RATELIMIT_TLS_CERT_FILE and RATELIMIT_TLS_CLIENT_CA_FILE")
+	}
+	return tlsConfig, nil
+}
+
+// Enabled reports whether the server is configured to serve HTTPS.
+func (t ServerTLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+func loadJWT() JWTConfig {
+	return JWTConfig{
+		Secret:        os.Getenv("RATELIMIT_JWT_SECRET"),
+		PublicKeyFile: os.Getenv("RATELIMIT_JWT_PUBLIC_KEY_FILE"),
+		JWKSFile:      os.Getenv("RATELIMIT_JWT_JWKS_FILE"),
+		SubjectClaim:  optionalString("RATELIMIT_JWT_SUBJECT_CLAIM", "sub"),
+		TenantClaim:   optionalString("RATELIMIT_JWT_TENANT_CLAIM", "org"),
+		TierClaim:     optionalString("RATELIMIT_JWT_TIER_CLAIM", "plan"),
+		Tiers:         os.Getenv("RATELIMIT_JWT_TIERS"),
+	}
+}
+
+// Enabled reports whether any verification key is configured.
+func (j JWTConfig) Enabled() bool {
+	return j.Secret != "" || j.PublicKeyFile != "" || j.JWKSFile != ""
+}
+
+func optionalString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func optionalInt(name string, fallback int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// StatusCodes returns the parsed Statuses, which LoadFromEnv has validated.
+func (p PenaltyConfig) StatusCodes() []int {
+	codes, _ := parseIntList(p.Statuses)
+	return codes
+}
+
+// TrustedProxyPrefixes returns the parsed TrustedProxies, which LoadFromEnv
+// has validated.
+func (c Config) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes, _ := parsePrefixList(c.TrustedProxies)
+	return prefixes
+}
+
+// parsePrefixList reads comma separated CIDRs, taking bare addresses as
+// single hosts.
+func parsePrefixList(raw string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func parseIntList(raw string) ([]int, error) {
+	values := make([]int, 0)
+	for _, item := range strings.Split(raw, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func optionalBool(name string, fallback bool) (bool, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return value, nil
+}
+
 func requiredString(name string) (string, error) {
 	value := os.Getenv(name)
 	if value == "" {
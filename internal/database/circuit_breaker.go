@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type CircuitBreakerConfig struct {
+	FailureThreshold  int
+	OpenTimeout       time.Duration
+	HalfOpenSuccesses int
+	OnStateChange     func(from, to CircuitState)
+}
+
+// CircuitBreaker tracks the health of one backend. The repositories wrapped
+// by the same breaker open and close together, so every store sharing a
+// Redis connection falls back as soon as any of them sees it fail. While
+// half-open only HalfOpenSuccesses trial calls reach the backend, so that a
+// recovering Redis is not hit by all the traffic at once.
+type CircuitBreaker struct {
+	config    CircuitBreakerConfig
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	successes int
+	trials    int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 1
+	}
+	if config.HalfOpenSuccesses <= 0 {
+		config.HalfOpenSuccesses = 1
+	}
+	return &CircuitBreaker{
+		config: config,
+		state:  CircuitClosed,
+		now:    time.Now,
+	}
+}
+
+type CircuitBreakerRepository struct {
+	*CircuitBreaker
+	next ports.RateLimitStateRepository
+}
+
+func NewCircuitBreakerRepository(next ports.RateLimitStateRepository, config CircuitBreakerConfig) *CircuitBreakerRepository {
+	return NewCircuitBreaker(config).Repository(next)
+}
+
+// Repository guards next with the breaker.
+func (cb *CircuitBreaker) Repository(next ports.RateLimitStateRepository) *CircuitBreakerRepository {
+	return &CircuitBreakerRepository{CircuitBreaker: cb, next: next}
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.refresh()
+	return cb.state
+}
+
+func (cb *CircuitBreakerRepository) Get(ctx context.Context, key string) (ratelimit.State, error) {
+	if err := cb.before(); err != nil {
+		return ratelimit.State{}, err
+	}
+	state, err := cb.next.Get(ctx, key)
+	cb.after(err)
+	return state, err
+}
+
+func (cb *CircuitBreakerRepository) Save(ctx context.Context, state ratelimit.State) error {
+	if err := cb.before(); err != nil {
+		return err
+	}
+	err := cb.next.Save(ctx, state)
+	cb.after(err)
+	return err
+}
+
+func (cb *CircuitBreakerRepository) ListKeys(ctx context.Context) ([]string, error) {
+	if err := cb.before(); err != nil {
+		return nil, err
+	}
+	keys, err := cb.next.ListKeys(ctx)
+	cb.after(err)
+	return keys, err
+}
+
+func (cb *CircuitBreakerRepository) Delete(ctx context.Context, key string) error {
+	if err := cb.before(); err != nil {
+		return err
+	}
+	err := cb.next.Delete(ctx, key)
+	cb.after(err)
+	return err
+}
+
+func (cb *CircuitBreaker) before() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.refresh()
+	switch cb.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if cb.trials >= cb.config.HalfOpenSuccesses {
+			return ErrCircuitOpen
+		}
+		cb.trials++
+	}
+	return nil
+}
+
+func (cb *CircuitBreaker) after(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if err != nil && !errors.Is(err, ports.ErrStateNotFound) {
+		cb.successes = 0
+		cb.failures++
+		if cb.state == CircuitHalfOpen || cb.failures >= cb.config.FailureThreshold {
+			cb.openedAt = cb.now()
+			cb.transition(CircuitOpen)
+		}
+		return
+	}
+
+	cb.failures = 0
+	if cb.state == CircuitHalfOpen {
+		cb.successes++
+		if cb.successes >= cb.config.HalfOpenSuccesses {
+			cb.transition(CircuitClosed)
+		}
+	}
+}
+
+// refresh moves an open circuit to half-open once the open timeout elapses.
+// Callers must hold cb.mu.
+func (cb *CircuitBreaker) refresh() {
+	if cb.state == CircuitOpen && !cb.now().Before(cb.openedAt.Add(cb.config.OpenTimeout)) {
+		cb.transition(CircuitHalfOpen)
+	}
+}
+
+func (cb *CircuitBreaker) transition(to CircuitState) {
+	from := cb.state
+	if from == to {
+		return
+	}
+	cb.state = to
+	cb.failures = 0
+	cb.successes = 0
+	cb.trials = 0
+	if cb.config.OnStateChange != nil {
+		cb.config.OnStateChange(from, to)
+	}
+}
+
+// Counter guards next with the breaker, keeping its Increment for stores such
+// as the hybrid one that push deltas.
+func (cb *CircuitBreaker) Counter(next ports.RateLimitCounterRepository) ports.RateLimitCounterRepository {
+	return &circuitBreakerCounter{CircuitBreakerRepository: cb.Repository(next), next: next}
+}
+
+// Concurrency guards next with the breaker.
+func (cb *CircuitBreaker) Concurrency(next ports.ConcurrencyRepository) ports.ConcurrencyRepository {
+	return &circuitBreakerConcurrency{breaker: cb, next: next}
+}
+
+// Quotas guards next with the breaker.
+func (cb *CircuitBreaker) Quotas(next ports.QuotaRepository) ports.QuotaRepository {
+	return &circuitBreakerQuotas{breaker: cb, next: next}
+}
+
+// Penalties guards next with the breaker.
+func (cb *CircuitBreaker) Penalties(next ports.PenaltyRepository) ports.PenaltyRepository {
+	return &circuitBreakerPenalties{breaker: cb, next: next}
+}
+
+type circuitBreakerCounter struct {
+	*CircuitBreakerRepository
+	next ports.RateLimitCounterRepository
+}
+
+func (c *circuitBreakerCounter) Increment(ctx context.Context, key string, delta int) (ratelimit.State, error) {
+	if err := c.before(); err != nil {
+		return ratelimit.State{}, err
+	}
+	state, err := c.next.Increment(ctx, key, delta)
+	c.after(err)
+	return state, err
+}
+
+// IncrementAll counts as a single call towards the breaker, however many keys
+// it carries.
+func (c *circuitBreakerCounter) IncrementAll(ctx context.Context, deltas map[string]int) (map[string]ratelimit.State, error) {
+	if err := c.before(); err != nil {
+		return nil, err
+	}
+	states, err := incrementAll(ctx, c.next, deltas)
+	c.after(err)
+	return states, err
+}
+
+type circuitBreakerConcurrency struct {
+	breaker *CircuitBreaker
+	next    ports.ConcurrencyRepository
+}
+
+func (c *circuitBreakerConcurrency) Acquire(ctx context.Context, key, id string, limit int, lease time.Duration) (int, bool, error) {
+	if err := c.breaker.before(); err != nil {
+		return 0, false, err
+	}
+	inFlight, acquired, err := c.next.Acquire(ctx, key, id, limit, lease)
+	c.breaker.after(err)
+	return inFlight, acquired, err
+}
+
+func (c *circuitBreakerConcurrency) Release(ctx context.Context, key, id string) error {
+	if err := c.breaker.before(); err != nil {
+		return err
+	}
+	err := c.next.Release(ctx, key, id)
+	c.breaker.after(err)
+	return err
+}
+
+type circuitBreakerQuotas struct {
+	breaker *CircuitBreaker
+	next    ports.QuotaRepository
+}
+
+func (q *circuitBreakerQuotas) Consume(ctx context.Context, key string, cost int, buckets []ports.QuotaBucket) ([]int, int, error) {
+	if err := q.breaker.before(); err != nil {
+		return nil, -1, err
+	}
+	used, exceeded, err := q.next.Consume(ctx, key, cost, buckets)
+	q.breaker.after(err)
+	return used, exceeded, err
+}
+
+type circuitBreakerPenalties struct {
+	breaker *CircuitBreaker
+	next    ports.PenaltyRepository
+}
+
+func (p *circuitBreakerPenalties) Penalize(ctx context.Context, key string, threshold int, window, block time.Duration) (time.Time, error) {
+	if err := p.breaker.before(); err != nil {
+		return time.Time{}, err
+	}
+	releaseAt, err := p.next.Penalize(ctx, key, threshold, window, block)
+	p.breaker.after(err)
+	return releaseAt, err
+}
+
+func (p *circuitBreakerPenalties) ReleaseAt(ctx context.Context, key string) (time.Time, error) {
+	if err := p.breaker.before(); err != nil {
+		return time.Time{}, err
+	}
+	releaseAt, err := p.next.ReleaseAt(ctx, key)
+	p.breaker.after(err)
+	return releaseAt, err
+}
+
+func (p *circuitBreakerPenalties) Clear(ctx context.Context, key string) error {
+	if err := p.breaker.before(); err != nil {
+		return err
+	}
+	err := p.next.Clear(ctx, key)
+	p.breaker.after(err)
+	return err
+}
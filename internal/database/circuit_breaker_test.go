@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+type stubRepository struct {
+	err   error
+	calls int
+}
+
+func (s *stubRepository) Get(ctx context.Context, key string) (ratelimit.State, error) {
+	s.calls++
+	return ratelimit.State{Key: key}, s.err
+}
+
+func (s *stubRepository) Save(ctx context.Context, state ratelimit.State) error {
+	s.calls++
+	return s.err
+}
+
+func (s *stubRepository) ListKeys(ctx context.Context) ([]string, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *stubRepository) Delete(ctx context.Context, key string) error {
+	s.calls++
+	return s.err
+}
+
+func TestCircuitBreakerRepository_OpensAfterThreshold(t *testing.T) {
+	stub := &stubRepository{err: errors.New("connection refused")}
+	breaker := NewCircuitBreakerRepository(stub, CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.Get(ctx, "k"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected call %d to reach the repository", i+1)
+		}
+	}
+
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected circuit to be open, got %s", breaker.State())
+	}
+
+	if _, err := breaker.Get(ctx, "k"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	if stub.calls != 2 {
+		t.Fatalf("expected open circuit to short-circuit, got %d repository calls", stub.calls)
+	}
+}
+
+func TestCircuitBreakerRepository_HalfOpenRecovery(t *testing.T) {
+	stub := &stubRepository{err: errors.New("connection refused")}
+	var transitions []CircuitState
+	breaker := NewCircuitBreakerRepository(stub, CircuitBreakerConfig{
+		FailureThreshold:  1,
+		OpenTimeout:       5 * time.Second,
+		HalfOpenSuccesses: 2,
+		OnStateChange: func(from, to CircuitState) {
+			transitions = append(transitions, to)
+		},
+	})
+	now := time.Unix(1700000000, 0)
+	breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_ = breaker.Save(ctx, ratelimit.State{Key: "k"})
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected circuit to be open, got %s", breaker.State())
+	}
+
+	now = now.Add(6 * time.Second)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("expected circuit to be half-open, got %s", breaker.State())
+	}
+
+	stub.err = nil
+	_ = breaker.Save(ctx, ratelimit.State{Key: "k"})
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("expected circuit to stay half-open after one success, got %s", breaker.State())
+	}
+
+	_ = breaker.Save(ctx, ratelimit.State{Key: "k"})
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected circuit to close, got %s", breaker.State())
+	}
+
+	expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(transitions) != len(expected) {
+		t.Fatalf("expected transitions %v, got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Fatalf("expected transitions %v, got %v", expected, transitions)
+		}
+	}
+}
+
+func TestCircuitBreaker_HalfOpenLimitsTrialCalls(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Second, HalfOpenSuccesses: 2})
+	now := time.Unix(1700000000, 0)
+	breaker.now = func() time.Time { return now }
+
+	breaker.after(errors.New("connection refused"))
+	now = now.Add(2 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		if err := breaker.before(); err != nil {
+			t.Fatalf("expected trial call %d to be let through, got %v", i+1, err)
+		}
+	}
+	if err := breaker.before(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected calls beyond the trials to be rejected, got %v", err)
+	}
+
+	breaker.after(nil)
+	breaker.after(nil)
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected circuit to close after the trials succeed, got %s", breaker.State())
+	}
+	if err := breaker.before(); err != nil {
+		t.Fatalf("expected a closed circuit to let calls through, got %v", err)
+	}
+}
+
+func TestCircuitBreakerRepository_HalfOpenFailureReopens(t *testing.T) {
+	stub := &stubRepository{err: errors.New("connection refused")}
+	breaker := NewCircuitBreakerRepository(stub, CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Second})
+	now := time.Unix(1700000000, 0)
+	breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_ = breaker.Delete(ctx, "k")
+	}
+	now = now.Add(2 * time.Second)
+
+	_ = breaker.Delete(ctx, "k")
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected a half-open failure to reopen the circuit, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerRepository_NotFoundIsNotAFailure(t *testing.T) {
+	stub := &stubRepository{err: ports.ErrStateNotFound}
+	breaker := NewCircuitBreakerRepository(stub, CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Second})
+
+	_, err := breaker.Get(context.Background(), "k")
+	if !errors.Is(err, ports.ErrStateNotFound) {
+		t.Fatalf("expected ports.ErrStateNotFound, got %v", err)
+	}
+
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected circuit to stay closed, got %s", breaker.State())
+	}
+}
+
+type failingQuotas struct {
+	calls int
+}
+
+func (f *failingQuotas) Consume(ctx context.Context, key string, cost int, buckets []ports.QuotaBucket) ([]int, int, error) {
+	f.calls++
+	return nil, -1, errors.New("connection refused")
+}
+
+func TestCircuitBreaker_SharedAcrossRepositories(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	quotas := &failingQuotas{}
+	guardedQuotas := breaker.Quotas(quotas)
+	stub := &stubRepository{}
+	repository := breaker.Repository(stub)
+	ctx := context.Background()
+
+	if _, _, err := guardedQuotas.Consume(ctx, "k", 1, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("expected the first call to reach the quota store")
+	}
+	if _, _, err := guardedQuotas.Consume(ctx, "k", 1, nil); !errors.Is(err, ErrCircuitOpen) || quotas.calls != 1 {
+		t.Fatalf("expected the open circuit to short-circuit quotas, got %v after %d calls", err, quotas.calls)
+	}
+	if _, err := repository.Get(ctx, "k"); !errors.Is(err, ErrCircuitOpen) || stub.calls != 0 {
+		t.Fatalf("expected the state store to share the open circuit, got %v after %d calls", err, stub.calls)
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// acquireScript keeps the in-flight leases of a key in a sorted set scored by
+// expiry: expired leases are dropped before counting, and a new lease is only
+// added while the set is below the limit.
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local count = redis.call('ZCARD', KEYS[1])
+if count >= tonumber(ARGV[3]) then
+	return {0, count}
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return {1, count + 1}
+`)
+
+type RedisConcurrencyRepository struct {
+	client *RedisClient
+	now    func() time.Time
+}
+
+func NewRedisConcurrencyRepository(client *RedisClient) *RedisConcurrencyRepository {
+	return &RedisConcurrencyRepository{client: client, now: time.Now}
+}
+
+func (r *RedisConcurrencyRepository) Acquire(ctx context.Context, key, id string, limit int, lease time.Duration) (int, bool, error) {
+	now := r.now()
+	result, err := acquireScript.Run(ctx, r.client.Client, []string{RedisKey(key, "inflight")},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit, id, lease.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return int(result[1]), result[0] == 1, nil
+}
+
+func (r *RedisConcurrencyRepository) Release(ctx context.Context, key, id string) error {
+	return r.client.Client.ZRem(ctx, RedisKey(key, "inflight"), id).Err()
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+func TestConcurrencyRepositories_LimitAndRelease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	repositories := map[string]ports.ConcurrencyRepository{
+		"memory": NewMemoryConcurrencyRepository(),
+		"redis":  NewRedisConcurrencyRepository(&client),
+	}
+	for name, repo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, ok, err := repo.Acquire(ctx, "10.0.0.1", "a", 2, time.Minute); err != nil || !ok {
+				t.Fatalf("expected first slot, got ok=%v err=%v", ok, err)
+			}
+			inFlight, ok, err := repo.Acquire(ctx, "10.0.0.1", "b", 2, time.Minute)
+			if err != nil || !ok || inFlight != 2 {
+				t.Fatalf("expected second slot with 2 in flight, got %d ok=%v err=%v", inFlight, ok, err)
+			}
+			if _, ok, _ := repo.Acquire(ctx, "10.0.0.1", "c", 2, time.Minute); ok {
+				t.Fatal("expected third slot to be denied")
+			}
+			if _, ok, _ := repo.Acquire(ctx, "10.0.0.2", "d", 2, time.Minute); !ok {
+				t.Fatal("expected other key to have its own slots")
+			}
+
+			if err := repo.Release(ctx, "10.0.0.1", "a"); err != nil {
+				t.Fatalf("release failed: %v", err)
+			}
+			if _, ok, _ := repo.Acquire(ctx, "10.0.0.1", "c", 2, time.Minute); !ok {
+				t.Fatal("expected released slot to be reusable")
+			}
+		})
+	}
+}
+
+func TestConcurrencyRepositories_ExpiredLeasesAreReclaimed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	now := time.Unix(1700000000, 0)
+	memory := NewMemoryConcurrencyRepository()
+	memory.now = func() time.Time { return now }
+	redisRepo := NewRedisConcurrencyRepository(&client)
+	redisRepo.now = func() time.Time { return now }
+
+	for name, repo := range map[string]ports.ConcurrencyRepository{"memory": memory, "redis": redisRepo} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, ok, _ := repo.Acquire(ctx, "10.0.0.1", "crashed", 1, time.Second); !ok {
+				t.Fatal("expected first slot")
+			}
+			if _, ok, _ := repo.Acquire(ctx, "10.0.0.1", "next", 1, time.Second); ok {
+				t.Fatal("expected slot to be held while the lease is valid")
+			}
+
+			now = now.Add(2 * time.Second)
+			if _, ok, _ := repo.Acquire(ctx, "10.0.0.1", "next", 1, time.Second); !ok {
+				t.Fatal("expected expired lease to be reclaimed")
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+// HybridRateLimitRepository counts requests locally and periodically pushes
+// the accumulated deltas to the remote store, pulling back the global count.
+// A key is flushed synchronously once its pending delta reaches maxOvershoot,
+// which bounds how far a replica can exceed the global limit between syncs.
+// Each sync only touches the keys written or read since the previous one.
+type HybridRateLimitRepository struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	remote       ports.RateLimitCounterRepository
+	syncInterval time.Duration
+	maxOvershoot int
+	mu           sync.Mutex
+	entries      map[string]*hybridEntry
+}
+
+type hybridEntry struct {
+	global  ratelimit.State
+	pending int
+	read    bool
+}
+
+func NewHybridRateLimitRepository(ctx context.Context, remote ports.RateLimitCounterRepository, syncInterval time.Duration, maxOvershoot int) *HybridRateLimitRepository {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &HybridRateLimitRepository{
+		ctx:          ctx,
+		cancel:       cancel,
+		remote:       remote,
+		syncInterval: syncInterval,
+		maxOvershoot: maxOvershoot,
+		entries:      make(map[string]*hybridEntry),
+	}
+	if syncInterval > 0 {
+		h.wg.Add(1)
+		go h.syncLoop()
+	}
+	return h
+}
+
+// Close stops the sync loop and flushes the remaining local deltas.
+func (h *HybridRateLimitRepository) Close(ctx context.Context) {
+	h.cancel()
+	h.wg.Wait()
+	h.Sync(ctx)
+}
+
+func (h *HybridRateLimitRepository) Get(ctx context.Context, key string) (ratelimit.State, error) {
+	h.mu.Lock()
+	entry, ok := h.entries[key]
+	if ok {
+		entry.read = true
+		state := entry.current()
+		h.mu.Unlock()
+		return state, nil
+	}
+	h.mu.Unlock()
+
+	state, err := h.remote.Get(ctx, key)
+	if err != nil {
+		return ratelimit.State{}, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if entry, ok := h.entries[key]; ok {
+		return entry.current(), nil
+	}
+	h.entries[key] = &hybridEntry{global: state}
+	return state, nil
+}
+
+func (h *HybridRateLimitRepository) Save(ctx context.Context, state ratelimit.State) error {
+	h.mu.Lock()
+	entry, ok := h.entries[state.Key]
+	if ok && state.BlockedAt == entry.global.BlockedAt && state.Strikes == entry.global.Strikes && state.Count >= entry.current().Count {
+		entry.pending += state.Count - entry.current().Count
+		flush := entry.pending > h.maxOvershoot
+		h.mu.Unlock()
+		if flush {
+			return h.flush(ctx, state.Key)
+		}
+		return nil
+	}
+	h.mu.Unlock()
+
+	// Blocks and resets must be visible to every replica right away.
+	if err := h.remote.Save(ctx, state); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.entries[state.Key] = &hybridEntry{global: state}
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *HybridRateLimitRepository) ListKeys(ctx context.Context) ([]string, error) {
+	return h.remote.ListKeys(ctx)
+}
+
+func (h *HybridRateLimitRepository) Delete(ctx context.Context, key string) error {
+	h.mu.Lock()
+	delete(h.entries, key)
+	h.mu.Unlock()
+	return h.remote.Delete(ctx, key)
+}
+
+// Sync pushes the pending deltas and refreshes the keys read since the last
+// sync, all in one batch. Keys left idle are dropped instead, so their next
+// read fetches the global count rather than serving a stale one.
+func (h *HybridRateLimitRepository) Sync(ctx context.Context) {
+	h.mu.Lock()
+	deltas := make(map[string]int)
+	synced := make(map[string]*hybridEntry)
+	for key, entry := range h.entries {
+		if entry.pending == 0 && !entry.read {
+			delete(h.entries, key)
+			continue
+		}
+		deltas[key] = entry.pending
+		synced[key] = entry
+		entry.pending = 0
+		entry.read = false
+	}
+	h.mu.Unlock()
+	if len(deltas) == 0 {
+		return
+	}
+
+	states, err := incrementAll(ctx, h.remote, deltas)
+	if err != nil {
+		log.Println("hybrid sync failed:", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, entry := range synced {
+		state, found := states[key]
+		h.settle(key, entry, deltas[key], state, found, err)
+	}
+}
+
+func (h *HybridRateLimitRepository) flush(ctx context.Context, key string) error {
+	h.mu.Lock()
+	entry, ok := h.entries[key]
+	if !ok {
+		h.mu.Unlock()
+		return nil
+	}
+	delta := entry.pending
+	entry.pending = 0
+	h.mu.Unlock()
+
+	state, err := h.remote.Increment(ctx, key, delta)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settle(key, entry, delta, state, err == nil, err)
+	return err
+}
+
+// settle records the outcome of pushing delta for entry: the global state
+// when the store returned one, the delta back on failure, and the entry
+// dropped when its state is gone from the store. Callers must hold h.mu.
+func (h *HybridRateLimitRepository) settle(key string, entry *hybridEntry, delta int, state ratelimit.State, found bool, err error) {
+	if current, ok := h.entries[key]; !ok || current != entry {
+		return
+	}
+	switch {
+	case found:
+		entry.global = state
+	case err != nil:
+		entry.pending += delta
+	case entry.pending == 0:
+		delete(h.entries, key)
+	}
+}
+
+func (h *HybridRateLimitRepository) syncLoop() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(h.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			h.Sync(h.ctx)
+		}
+	}
+}
+
+func (e *hybridEntry) current() ratelimit.State {
+	state := e.global
+	state.Count += e.pending
+	return state
+}
+
+// incrementAll applies deltas through counter's IncrementAll when it has one,
+// and one key at a time otherwise.
+func incrementAll(ctx context.Context, counter ports.RateLimitCounterRepository, deltas map[string]int) (map[string]ratelimit.State, error) {
+	if batch, ok := counter.(ports.RateLimitBatchCounter); ok {
+		return batch.IncrementAll(ctx, deltas)
+	}
+
+	states := make(map[string]ratelimit.State, len(deltas))
+	var failed error
+	for key, delta := range deltas {
+		var state ratelimit.State
+		var err error
+		if delta > 0 {
+			state, err = counter.Increment(ctx, key, delta)
+		} else {
+			state, err = counter.Get(ctx, key)
+		}
+		if errors.Is(err, ports.ErrStateNotFound) {
+			continue
+		}
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		states[key] = state
+	}
+	return states, failed
+}
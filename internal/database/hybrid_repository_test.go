@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+func newHybridTestRepositories(t *testing.T, maxOvershoot int) (*HybridRateLimitRepository, *HybridRateLimitRepository, *RedisRateLimitRepository) {
+	t.Helper()
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+
+	remote := NewRedisRateLimitRepository(&client)
+	first := NewHybridRateLimitRepository(context.Background(), remote, 0, maxOvershoot)
+	second := NewHybridRateLimitRepository(context.Background(), remote, 0, maxOvershoot)
+	return first, second, remote
+}
+
+func increment(t *testing.T, repo *HybridRateLimitRepository, key string) {
+	t.Helper()
+
+	ctx := context.Background()
+	state, err := repo.Get(ctx, key)
+	if err != nil {
+		state = ratelimit.NewState(key)
+		if err := repo.Save(ctx, state); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	state.Count++
+	if err := repo.Save(ctx, state); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+}
+
+func TestHybridRateLimitRepository_CountsLocallyUntilSync(t *testing.T) {
+	first, second, remote := newHybridTestRepositories(t, 100)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		increment(t, first, "127.0.0.1")
+	}
+	for i := 0; i < 2; i++ {
+		increment(t, second, "127.0.0.1")
+	}
+
+	stored, err := remote.Get(ctx, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if stored.Count != 0 {
+		t.Fatalf("expected remote count to lag before sync, got %d", stored.Count)
+	}
+
+	first.Sync(ctx)
+	second.Sync(ctx)
+	first.Sync(ctx)
+
+	stored, _ = remote.Get(ctx, "127.0.0.1")
+	if stored.Count != 5 {
+		t.Fatalf("expected global count 5 after sync, got %d", stored.Count)
+	}
+
+	local, _ := first.Get(ctx, "127.0.0.1")
+	if local.Count != 5 {
+		t.Fatalf("expected replica to pull back global count 5, got %d", local.Count)
+	}
+}
+
+func TestHybridRateLimitRepository_FlushesWhenOvershootReached(t *testing.T) {
+	first, _, remote := newHybridTestRepositories(t, 1)
+	ctx := context.Background()
+
+	increment(t, first, "127.0.0.1")
+	stored, _ := remote.Get(ctx, "127.0.0.1")
+	if stored.Count != 0 {
+		t.Fatalf("expected first increment to stay local, got %d", stored.Count)
+	}
+
+	increment(t, first, "127.0.0.1")
+	stored, _ = remote.Get(ctx, "127.0.0.1")
+	if stored.Count != 2 {
+		t.Fatalf("expected synchronous flush once overshoot is exceeded, got %d", stored.Count)
+	}
+}
+
+func TestHybridRateLimitRepository_BlocksAreWrittenThrough(t *testing.T) {
+	first, second, remote := newHybridTestRepositories(t, 100)
+	ctx := context.Background()
+
+	increment(t, first, "127.0.0.1")
+	increment(t, second, "127.0.0.1")
+	if err := first.Save(ctx, ratelimit.State{Key: "127.0.0.1", BlockedAt: 1700000000}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	stored, _ := remote.Get(ctx, "127.0.0.1")
+	if stored.BlockedAt != 1700000000 {
+		t.Fatalf("expected block to be persisted immediately, got %#v", stored)
+	}
+
+	second.Sync(ctx)
+	local, _ := second.Get(ctx, "127.0.0.1")
+	if local.BlockedAt != 1700000000 {
+		t.Fatalf("expected other replica to observe the block after sync, got %#v", local)
+	}
+}
+
+func TestHybridRateLimitRepository_CloseFlushesPendingDeltas(t *testing.T) {
+	first, _, remote := newHybridTestRepositories(t, 100)
+	ctx := context.Background()
+
+	increment(t, first, "127.0.0.1")
+	increment(t, first, "127.0.0.1")
+	first.Close(ctx)
+
+	stored, err := remote.Get(ctx, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if stored.Count != 2 {
+		t.Fatalf("expected pending deltas to be flushed on close, got %d", stored.Count)
+	}
+}
+
+func TestHybridRateLimitRepository_SyncSkipsIdleKeys(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	client, err := NewRedisClient(ctx, mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	remote := NewRedisRateLimitRepository(&client)
+	first := NewHybridRateLimitRepository(ctx, remote, 0, 100)
+	second := NewHybridRateLimitRepository(ctx, remote, 0, 100)
+
+	increment(t, first, "10.0.0.1")
+	increment(t, first, "10.0.0.2")
+	first.Sync(ctx)
+
+	commands := mr.CommandCount()
+	first.Sync(ctx)
+	first.Sync(ctx)
+	if sent := mr.CommandCount() - commands; sent != 0 {
+		t.Fatalf("expected idle keys to cost no Redis calls, got %d", sent)
+	}
+
+	increment(t, second, "10.0.0.1")
+	second.Sync(ctx)
+	local, err := first.Get(ctx, "10.0.0.1")
+	if err != nil || local.Count != 2 {
+		t.Fatalf("expected an idle key to be fetched again, got %+v, %v", local, err)
+	}
+}
+
+func TestHybridRateLimitRepository_SyncFailuresOpenTheBreaker(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	repo := NewHybridRateLimitRepository(context.Background(), breaker.Counter(NewRedisRateLimitRepository(&client)), 0, 100)
+	increment(t, repo, "10.0.0.1")
+	increment(t, repo, "10.0.0.1")
+
+	mr.Close()
+	repo.Sync(context.Background())
+
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected a failed sync to open the circuit, got %s", breaker.State())
+	}
+	if state, err := repo.Get(context.Background(), "10.0.0.1"); err != nil || state.Count != 2 {
+		t.Fatalf("expected local counts to survive the outage, got %+v, %v", state, err)
+	}
+}
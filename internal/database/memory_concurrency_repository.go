@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryConcurrencyRepository struct {
+	mu     sync.Mutex
+	leases map[string]map[string]time.Time
+	now    func() time.Time
+}
+
+func NewMemoryConcurrencyRepository() *MemoryConcurrencyRepository {
+	return &MemoryConcurrencyRepository{
+		leases: make(map[string]map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (m *MemoryConcurrencyRepository) Acquire(ctx context.Context, key, id string, limit int, lease time.Duration) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	slots := m.leases[key]
+	for slot, expiresAt := range slots {
+		if !expiresAt.After(now) {
+			delete(slots, slot)
+		}
+	}
+	if len(slots) >= limit {
+		return len(slots), false, nil
+	}
+	if slots == nil {
+		slots = make(map[string]time.Time)
+		m.leases[key] = slots
+	}
+	slots[id] = now.Add(lease)
+	return len(slots), true, nil
+}
+
+func (m *MemoryConcurrencyRepository) Release(ctx context.Context, key, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slots := m.leases[key]
+	delete(slots, id)
+	if len(slots) == 0 {
+		delete(m.leases, key)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"container/list"
+	"errors"
+)
+
+// ErrStoreFull is returned by the memory stores that refuse new keys once
+// they hold maxKeys live entries, rather than evicting one that still counts.
+var ErrStoreFull = errors.New("memory store is full")
+
+// memoryLRU is a map bounded to maxKeys entries, evicting the least recently
+// used ones; zero leaves it unbounded. Callers that must not lose entries
+// check fits before adding keys. It is not safe for concurrent use.
+type memoryLRU[V any] struct {
+	maxKeys int
+	items   map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryLRUEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newMemoryLRU[V any](maxKeys int) *memoryLRU[V] {
+	return &memoryLRU[V]{
+		maxKeys: max(maxKeys, 0),
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (m *memoryLRU[V]) get(key string) (V, bool) {
+	elem, ok := m.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	m.lru.MoveToFront(elem)
+	return elem.Value.(*memoryLRUEntry[V]).value, true
+}
+
+// fits reports whether n new keys can be added without evicting any entry.
+func (m *memoryLRU[V]) fits(n int) bool {
+	return m.maxKeys == 0 || m.lru.Len()+n <= m.maxKeys
+}
+
+func (m *memoryLRU[V]) has(key string) bool {
+	_, ok := m.items[key]
+	return ok
+}
+
+// admits reports whether key can be set without evicting another entry.
+func (m *memoryLRU[V]) admits(key string) bool {
+	return m.has(key) || m.fits(1)
+}
+
+func (m *memoryLRU[V]) set(key string, value V) {
+	if elem, ok := m.items[key]; ok {
+		elem.Value.(*memoryLRUEntry[V]).value = value
+		m.lru.MoveToFront(elem)
+		return
+	}
+
+	m.items[key] = m.lru.PushFront(&memoryLRUEntry[V]{key: key, value: value})
+	for m.maxKeys > 0 && m.lru.Len() > m.maxKeys {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *memoryLRU[V]) keys() []string {
+	keys := make([]string, 0, len(m.items))
+	for key := range m.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (m *memoryLRU[V]) delete(key string) {
+	if elem, ok := m.items[key]; ok {
+		m.remove(elem)
+	}
+}
+
+// deleteIf drops every entry whose value matches expired.
+func (m *memoryLRU[V]) deleteIf(expired func(V) bool) {
+	for _, elem := range m.items {
+		if expired(elem.Value.(*memoryLRUEntry[V]).value) {
+			m.remove(elem)
+		}
+	}
+}
+
+func (m *memoryLRU[V]) remove(elem *list.Element) {
+	delete(m.items, elem.Value.(*memoryLRUEntry[V]).key)
+	m.lru.Remove(elem)
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryPenaltyRepository struct {
+	mu        sync.Mutex
+	counters  *memoryLRU[memoryQuotaCounter]
+	boxes     *memoryLRU[time.Time]
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryPenaltyRepository keeps counters and boxed keys in process memory,
+// up to maxKeys each; zero disables the bound. Live entries are never
+// evicted, since that would release a boxed key or locked account: once
+// full, penalizing new keys fails with ErrStoreFull until some expire.
+func NewMemoryPenaltyRepository(maxKeys int) *MemoryPenaltyRepository {
+	return &MemoryPenaltyRepository{
+		counters: newMemoryLRU[memoryQuotaCounter](maxKeys),
+		boxes:    newMemoryLRU[time.Time](maxKeys),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryPenaltyRepository) Penalize(ctx context.Context, key string, threshold int, window, block time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	counter, _ := m.counters.get(key)
+	if !counter.expireAt.After(now) {
+		counter = memoryQuotaCounter{expireAt: now.Add(window)}
+	}
+	counter.used++
+	if counter.used < threshold {
+		if !m.counters.admits(key) {
+			m.expire(now)
+		}
+		if !m.counters.admits(key) {
+			return time.Time{}, ErrStoreFull
+		}
+		m.counters.set(key, counter)
+		return time.Time{}, nil
+	}
+
+	if !m.boxes.admits(key) {
+		m.expire(now)
+	}
+	if !m.boxes.admits(key) {
+		return time.Time{}, ErrStoreFull
+	}
+	m.counters.delete(key)
+	releaseAt := now.Add(block)
+	m.boxes.set(key, releaseAt)
+	return releaseAt, nil
+}
+
+func (m *MemoryPenaltyRepository) ReleaseAt(ctx context.Context, key string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	releaseAt, ok := m.boxes.get(key)
+	if !ok || !releaseAt.After(m.now()) {
+		return time.Time{}, nil
+	}
+	return releaseAt, nil
+}
+
+func (m *MemoryPenaltyRepository) Clear(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counters.delete(key)
+	m.boxes.delete(key)
+	return nil
+}
+
+// sweep drops expired counters and boxes, at most once per interval.
+func (m *MemoryPenaltyRepository) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+	m.nextSweep = now.Add(memoryQuotaSweepInterval)
+	m.expire(now)
+}
+
+func (m *MemoryPenaltyRepository) expire(now time.Time) {
+	m.counters.deleteIf(func(counter memoryQuotaCounter) bool {
+		return !counter.expireAt.After(now)
+	})
+	m.boxes.deleteIf(func(releaseAt time.Time) bool {
+		return !releaseAt.After(now)
+	})
+}
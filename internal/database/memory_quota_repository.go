@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+const memoryQuotaSweepInterval = time.Minute
+
+type MemoryQuotaRepository struct {
+	mu        sync.Mutex
+	counters  *memoryLRU[memoryQuotaCounter]
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+type memoryQuotaCounter struct {
+	used     int
+	expireAt time.Time
+}
+
+// NewMemoryQuotaRepository keeps counters in process memory, up to maxKeys;
+// zero disables the bound. Live counters are never evicted, since that would
+// reset a quota: once full, charges to new counters fail with ErrStoreFull
+// until some expire.
+func NewMemoryQuotaRepository(maxKeys int) *MemoryQuotaRepository {
+	return &MemoryQuotaRepository{
+		counters: newMemoryLRU[memoryQuotaCounter](maxKeys),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryQuotaRepository) Consume(ctx context.Context, key string, cost int, buckets []ports.QuotaBucket) ([]int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	used := make([]int, len(buckets))
+	exceeded := -1
+	for i, bucket := range buckets {
+		counter, _ := m.counters.get(key + "|" + bucket.Name)
+		if !counter.expireAt.After(now) {
+			counter = memoryQuotaCounter{}
+		}
+		used[i] = counter.used
+		if exceeded < 0 && cost > bucket.Limit-counter.used {
+			exceeded = i
+		}
+	}
+	if exceeded >= 0 {
+		return used, exceeded, nil
+	}
+	if cost > 0 && !m.counters.fits(m.missing(key, buckets)) {
+		m.expire(now)
+		if !m.counters.fits(m.missing(key, buckets)) {
+			return nil, -1, ErrStoreFull
+		}
+	}
+
+	for i, bucket := range buckets {
+		used[i] = max(used[i]+cost, 0)
+		// A refund to a counter that is gone has nothing to give back to.
+		if name := key + "|" + bucket.Name; m.counters.admits(name) {
+			m.counters.set(name, memoryQuotaCounter{used: used[i], expireAt: bucket.ExpireAt})
+		}
+	}
+	return used, -1, nil
+}
+
+// missing counts the buckets of key without a counter yet.
+func (m *MemoryQuotaRepository) missing(key string, buckets []ports.QuotaBucket) int {
+	n := 0
+	for _, bucket := range buckets {
+		if !m.counters.has(key + "|" + bucket.Name) {
+			n++
+		}
+	}
+	return n
+}
+
+// sweep drops expired counters, at most once per interval.
+func (m *MemoryQuotaRepository) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+	m.nextSweep = now.Add(memoryQuotaSweepInterval)
+	m.expire(now)
+}
+
+func (m *MemoryQuotaRepository) expire(now time.Time) {
+	m.counters.deleteIf(func(counter memoryQuotaCounter) bool {
+		return !counter.expireAt.After(now)
+	})
+}
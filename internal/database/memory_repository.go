@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+const defaultMemoryShards = 32
+
+type MemoryRateLimitRepository struct {
+	shards []*memoryShard
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+type memoryShard struct {
+	mu      sync.Mutex
+	entries *memoryLRU[memoryEntry]
+}
+
+type memoryEntry struct {
+	state     ratelimit.State
+	expiresAt time.Time
+}
+
+// NewMemoryRateLimitRepository keeps state in process memory. maxKeys bounds
+// the total number of keys (evicting the least recently used ones) and ttl
+// expires keys that have not been saved for that long; zero disables either.
+func NewMemoryRateLimitRepository(shards, maxKeys int, ttl time.Duration) *MemoryRateLimitRepository {
+	if shards <= 0 {
+		shards = defaultMemoryShards
+	}
+	if maxKeys > 0 {
+		// Every shard must hold at least one key.
+		shards = min(shards, maxKeys)
+	}
+
+	repo := &MemoryRateLimitRepository{
+		shards: make([]*memoryShard, shards),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+	for i := range repo.shards {
+		// The remainder goes to the first shards, so the capacities add up
+		// to exactly maxKeys.
+		perShard := 0
+		if maxKeys > 0 {
+			perShard = maxKeys / shards
+			if i < maxKeys%shards {
+				perShard++
+			}
+		}
+		repo.shards[i] = &memoryShard{entries: newMemoryLRU[memoryEntry](perShard)}
+	}
+	return repo
+}
+
+func (m *MemoryRateLimitRepository) Get(ctx context.Context, key string) (ratelimit.State, error) {
+	shard := m.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	entry, ok := shard.entries.get(key)
+	if !ok {
+		return ratelimit.State{}, ports.ErrStateNotFound
+	}
+	if m.expired(entry) {
+		shard.entries.delete(key)
+		return ratelimit.State{}, ports.ErrStateNotFound
+	}
+	return entry.state, nil
+}
+
+func (m *MemoryRateLimitRepository) Save(ctx context.Context, state ratelimit.State) error {
+	shard := m.shardFor(state.Key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	var expiresAt time.Time
+	if m.ttl > 0 {
+		expiresAt = m.now().Add(m.ttl)
+	}
+	shard.entries.set(state.Key, memoryEntry{state: state, expiresAt: expiresAt})
+	return nil
+}
+
+func (m *MemoryRateLimitRepository) ListKeys(ctx context.Context) ([]string, error) {
+	keys := make([]string, 0)
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		shard.entries.deleteIf(m.expired)
+		keys = append(keys, shard.entries.keys()...)
+		shard.mu.Unlock()
+	}
+	return keys, nil
+}
+
+func (m *MemoryRateLimitRepository) Delete(ctx context.Context, key string) error {
+	shard := m.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.entries.delete(key)
+	return nil
+}
+
+func (m *MemoryRateLimitRepository) shardFor(key string) *memoryShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return m.shards[h.Sum32()%uint32(len(m.shards))]
+}
+
+func (m *MemoryRateLimitRepository) expired(entry memoryEntry) bool {
+	return !entry.expiresAt.IsZero() && !m.now().Before(entry.expiresAt)
+}
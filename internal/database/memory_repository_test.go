@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+func TestMemoryRateLimitRepository_CRUD(t *testing.T) {
+	repo := NewMemoryRateLimitRepository(4, 0, 0)
+	ctx := context.Background()
+
+	state := ratelimit.State{Key: "127.0.0.1", Count: 3, BlockedAt: 1700000000}
+	if err := repo.Save(ctx, state); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loaded, err := repo.Get(ctx, state.Key)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if loaded != state {
+		t.Fatalf("expected state %#v, got %#v", state, loaded)
+	}
+
+	keys, err := repo.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("list keys failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(keys))
+	}
+
+	if err := repo.Delete(ctx, state.Key); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := repo.Get(ctx, state.Key); !errors.Is(err, ports.ErrStateNotFound) {
+		t.Fatalf("expected ports.ErrStateNotFound, got %v", err)
+	}
+}
+
+func TestMemoryRateLimitRepository_ExpiresKeys(t *testing.T) {
+	repo := NewMemoryRateLimitRepository(1, 0, time.Second)
+	now := time.Unix(1700000000, 0)
+	repo.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_ = repo.Save(ctx, ratelimit.State{Key: "a", Count: 1})
+
+	now = now.Add(500 * time.Millisecond)
+	if _, err := repo.Get(ctx, "a"); err != nil {
+		t.Fatalf("expected key to be alive, got %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := repo.Get(ctx, "a"); !errors.Is(err, ports.ErrStateNotFound) {
+		t.Fatalf("expected expired key to be gone, got %v", err)
+	}
+}
+
+func TestMemoryRateLimitRepository_EvictsLeastRecentlyUsed(t *testing.T) {
+	repo := NewMemoryRateLimitRepository(1, 2, 0)
+	ctx := context.Background()
+
+	_ = repo.Save(ctx, ratelimit.State{Key: "a"})
+	_ = repo.Save(ctx, ratelimit.State{Key: "b"})
+	if _, err := repo.Get(ctx, "a"); err != nil {
+		t.Fatalf("expected a to exist, got %v", err)
+	}
+	_ = repo.Save(ctx, ratelimit.State{Key: "c"})
+
+	if _, err := repo.Get(ctx, "b"); !errors.Is(err, ports.ErrStateNotFound) {
+		t.Fatalf("expected b to be evicted, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := repo.Get(ctx, key); err != nil {
+			t.Fatalf("expected %s to exist, got %v", key, err)
+		}
+	}
+}
+
+func TestNewMemoryRateLimitRepository_ShardCapacityAddsUpToMaxKeys(t *testing.T) {
+	for _, tc := range []struct{ shards, maxKeys int }{{32, 100}, {4, 3}, {3, 10}} {
+		repo := NewMemoryRateLimitRepository(tc.shards, tc.maxKeys, 0)
+		total := 0
+		for _, shard := range repo.shards {
+			if shard.entries.maxKeys <= 0 {
+				t.Fatalf("%d shards, %d keys: expected every shard to hold a key", tc.shards, tc.maxKeys)
+			}
+			total += shard.entries.maxKeys
+		}
+		if total != tc.maxKeys {
+			t.Fatalf("%d shards, %d keys: expected total capacity %d, got %d", tc.shards, tc.maxKeys, tc.maxKeys, total)
+		}
+	}
+}
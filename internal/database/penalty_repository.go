@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// penalizeScript counts a bad response in KEYS[1], whose window starts with
+// the first one, and boxes the key in KEYS[2] until ARGV[3] (unix ms) once the
+// count reaches ARGV[1]. The counter starts over after a box.
+var penalizeScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if count < tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], ARGV[3])
+redis.call('PEXPIREAT', KEYS[2], ARGV[3])
+return tonumber(ARGV[3])
+`)
+
+type RedisPenaltyRepository struct {
+	client *RedisClient
+	now    func() time.Time
+}
+
+func NewRedisPenaltyRepository(client *RedisClient) *RedisPenaltyRepository {
+	return &RedisPenaltyRepository{client: client, now: time.Now}
+}
+
+func (r *RedisPenaltyRepository) Penalize(ctx context.Context, key string, threshold int, window, block time.Duration) (time.Time, error) {
+	keys := []string{RedisKey(key, "penalty"), RedisKey(key, "penalty", "box")}
+	releaseAt, err := penalizeScript.Run(ctx, r.client.Client, keys,
+		threshold, window.Milliseconds(), r.now().Add(block).UnixMilli()).Int64()
+	if err != nil || releaseAt == 0 {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(releaseAt), nil
+}
+
+func (r *RedisPenaltyRepository) ReleaseAt(ctx context.Context, key string) (time.Time, error) {
+	releaseAt, err := r.client.Client.Get(ctx, RedisKey(key, "penalty", "box")).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(releaseAt), nil
+}
+
+func (r *RedisPenaltyRepository) Clear(ctx context.Context, key string) error {
+	return r.client.Client.Del(ctx, RedisKey(key, "penalty"), RedisKey(key, "penalty", "box")).Err()
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+func TestPenaltyRepositories_BoxAtThreshold(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	repositories := map[string]ports.PenaltyRepository{
+		"memory": NewMemoryPenaltyRepository(0),
+		"redis":  NewRedisPenaltyRepository(&client),
+	}
+	for name, repo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				releaseAt, err := repo.Penalize(ctx, "10.0.0.1", 3, time.Minute, time.Hour)
+				if err != nil || !releaseAt.IsZero() {
+					t.Fatalf("expected key to stay out of the box, got %v, %v", releaseAt, err)
+				}
+			}
+			if releaseAt, err := repo.ReleaseAt(ctx, "10.0.0.1"); err != nil || !releaseAt.IsZero() {
+				t.Fatalf("expected key not to be boxed yet, got %v, %v", releaseAt, err)
+			}
+
+			boxedUntil, err := repo.Penalize(ctx, "10.0.0.1", 3, time.Minute, time.Hour)
+			if err != nil || time.Until(boxedUntil) <= 59*time.Minute {
+				t.Fatalf("expected key to be boxed for an hour, got %v, %v", boxedUntil, err)
+			}
+
+			releaseAt, err := repo.ReleaseAt(ctx, "10.0.0.1")
+			if err != nil || !releaseAt.Equal(boxedUntil) {
+				t.Fatalf("expected release at %v, got %v, %v", boxedUntil, releaseAt, err)
+			}
+			if releaseAt, _ := repo.ReleaseAt(ctx, "10.0.0.2"); !releaseAt.IsZero() {
+				t.Fatalf("expected other keys to stay out of the box, got %v", releaseAt)
+			}
+
+			if err := repo.Clear(ctx, "10.0.0.1"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if releaseAt, _ := repo.ReleaseAt(ctx, "10.0.0.1"); !releaseAt.IsZero() {
+				t.Fatalf("expected cleared key to be let out, got %v", releaseAt)
+			}
+		})
+	}
+}
+
+func TestMemoryPenaltyRepository_RefusesNewKeysWhenFull(t *testing.T) {
+	repo := NewMemoryPenaltyRepository(1)
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := repo.Penalize(ctx, "a", 1, time.Minute, time.Hour); err != nil {
+		t.Fatalf("expected a to be boxed, got %v", err)
+	}
+	if _, err := repo.Penalize(ctx, "b", 1, time.Minute, time.Hour); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("expected a new box to be refused, got %v", err)
+	}
+	if _, err := repo.Penalize(ctx, "c", 2, time.Minute, time.Hour); err != nil {
+		t.Fatalf("expected counters to have their own room, got %v", err)
+	}
+	if _, err := repo.Penalize(ctx, "d", 2, time.Minute, time.Hour); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("expected a new counter to be refused, got %v", err)
+	}
+	if releaseAt, _ := repo.ReleaseAt(ctx, "a"); releaseAt.IsZero() {
+		t.Fatal("expected a to stay boxed")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := repo.Penalize(ctx, "b", 1, time.Minute, time.Hour); err != nil {
+		t.Fatalf("expected room once boxes expire, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+// consumeQuotaScript checks every bucket of a key before touching any of them,
+// so a request denied by the monthly quota is not charged to the daily one.
+// ARGV[1] is the cost, followed by a limit and an expiry (unix ms) per key. A
+// negative cost refunds a previous charge.
+var consumeQuotaScript = redis.NewScript(`
+local cost = tonumber(ARGV[1])
+local used = {}
+local exceeded = 0
+for i, key in ipairs(KEYS) do
+	used[i] = tonumber(redis.call('GET', key) or '0')
+	if exceeded == 0 and cost > tonumber(ARGV[2 * i]) - used[i] then
+		exceeded = i
+	end
+end
+if exceeded == 0 then
+	for i, key in ipairs(KEYS) do
+		used[i] = redis.call('INCRBY', key, cost)
+		if used[i] < 0 then
+			redis.call('SET', key, 0)
+			used[i] = 0
+		end
+		redis.call('PEXPIREAT', key, ARGV[2 * i + 1])
+	end
+end
+table.insert(used, 1, exceeded)
+return used
+`)
+
+type RedisQuotaRepository struct {
+	client *RedisClient
+}
+
+func NewRedisQuotaRepository(client *RedisClient) *RedisQuotaRepository {
+	return &RedisQuotaRepository{client: client}
+}
+
+func (r *RedisQuotaRepository) Consume(ctx context.Context, key string, cost int, buckets []ports.QuotaBucket) ([]int, int, error) {
+	keys := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, 1+2*len(buckets))
+	args = append(args, cost)
+	for _, bucket := range buckets {
+		keys = append(keys, RedisKey(key, bucket.Name))
+		args = append(args, bucket.Limit, bucket.ExpireAt.UnixMilli())
+	}
+
+	result, err := consumeQuotaScript.Run(ctx, r.client.Client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	used := make([]int, len(buckets))
+	for i := range used {
+		used[i] = int(result[i+1])
+	}
+	return used, int(result[0]) - 1, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+func TestQuotaRepositories_ConsumeAllOrNothing(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	expireAt := time.Now().Add(time.Hour)
+	buckets := []ports.QuotaBucket{
+		{Name: "quota:day:2026-10-19", Limit: 10, ExpireAt: expireAt},
+		{Name: "quota:month:2026-10", Limit: 3, ExpireAt: expireAt},
+	}
+
+	repositories := map[string]ports.QuotaRepository{
+		"memory": NewMemoryQuotaRepository(0),
+		"redis":  NewRedisQuotaRepository(&client),
+	}
+	for name, repo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			used, exceeded, err := repo.Consume(ctx, "10.0.0.1", 2, buckets)
+			if err != nil || exceeded != -1 || used[0] != 2 || used[1] != 2 {
+				t.Fatalf("unexpected first consume: used=%v exceeded=%d err=%v", used, exceeded, err)
+			}
+
+			used, exceeded, err = repo.Consume(ctx, "10.0.0.1", 2, buckets)
+			if err != nil || exceeded != 1 || used[0] != 2 || used[1] != 2 {
+				t.Fatalf("expected monthly bucket to overflow without charging the daily one: used=%v exceeded=%d err=%v", used, exceeded, err)
+			}
+
+			used, exceeded, _ = repo.Consume(ctx, "10.0.0.1", 1, buckets)
+			if exceeded != -1 || used[0] != 3 || used[1] != 3 {
+				t.Fatalf("expected request fitting both quotas to be charged: used=%v exceeded=%d", used, exceeded)
+			}
+
+			used, exceeded, _ = repo.Consume(ctx, "10.0.0.1", math.MaxInt, buckets)
+			if exceeded != 0 || used[0] != 3 {
+				t.Fatalf("expected an oversized cost to be denied without overflowing: used=%v exceeded=%d", used, exceeded)
+			}
+		})
+	}
+}
+
+func TestRedisQuotaRepository_SurvivesStateCleanup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := NewRedisClient(context.Background(), mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	quotas := NewRedisQuotaRepository(&client)
+	states := NewRedisRateLimitRepository(&client)
+	bucket := []ports.QuotaBucket{{Name: "quota:month:2026-10", Limit: 100, ExpireAt: time.Now().Add(time.Hour)}}
+
+	if _, _, err := quotas.Consume(ctx, "10.0.0.1", 5, bucket); err != nil {
+		t.Fatalf("consume failed: %v", err)
+	}
+
+	keys, err := states.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("list keys failed: %v", err)
+	}
+	for _, key := range keys {
+		if err := states.Delete(ctx, key); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+	}
+
+	used, _, err := quotas.Consume(ctx, "10.0.0.1", 1, bucket)
+	if err != nil || used[0] != 6 {
+		t.Fatalf("expected quota to survive cleanup, got used=%v err=%v", used, err)
+	}
+	if ttl := mr.TTL("{10.0.0.1}:quota:month:2026-10"); ttl <= 0 {
+		t.Fatalf("expected quota counter to expire with its period, got ttl %s", ttl)
+	}
+}
+
+func TestMemoryQuotaRepository_RefusesNewKeysWhenFull(t *testing.T) {
+	repo := NewMemoryQuotaRepository(2)
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	ctx := context.Background()
+	buckets := []ports.QuotaBucket{{Name: "day", Limit: 1, ExpireAt: now.Add(time.Hour)}}
+
+	for _, key := range []string{"a", "b"} {
+		if _, exceeded, err := repo.Consume(ctx, key, 1, buckets); err != nil || exceeded != -1 {
+			t.Fatalf("expected %s to be charged, got %d %v", key, exceeded, err)
+		}
+	}
+	if _, _, err := repo.Consume(ctx, "c", 1, buckets); !errors.Is(err, ErrStoreFull) {
+		t.Fatalf("expected a new key to be refused, got %v", err)
+	}
+	if _, exceeded, _ := repo.Consume(ctx, "a", 1, buckets); exceeded != 0 {
+		t.Fatal("expected the quota of a to be kept")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, exceeded, err := repo.Consume(ctx, "c", 1, buckets); err != nil || exceeded != -1 {
+		t.Fatalf("expected room once counters expire, got %d %v", exceeded, err)
+	}
+}
@@ -4,11 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
 	"github.com/xavierpms/rate-limiter/internal/ports"
 )
 
+// incrementScript adds ARGV[2] to the stored count in a single round trip so
+// concurrent replicas flushing deltas never overwrite each other.
+var incrementScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+local state
+if raw then
+	state = cjson.decode(raw)
+else
+	state = {key = ARGV[1], count = 0, blocked_at = 0}
+end
+state.count = state.count + tonumber(ARGV[2])
+local encoded = cjson.encode(state)
+redis.call('SET', KEYS[1], encoded)
+return encoded
+`)
+
 type RedisRateLimitRepository struct {
 	client *RedisClient
 }
@@ -18,7 +36,7 @@ func NewRedisRateLimitRepository(client *RedisClient) *RedisRateLimitRepository
 }
 
 func (r *RedisRateLimitRepository) Get(ctx context.Context, key string) (ratelimit.State, error) {
-	raw, err := r.client.Get(ctx, key)
+	raw, err := r.client.Get(ctx, RedisKey(key))
 	if errors.Is(err, ErrNotFound) {
 		return ratelimit.State{}, ports.ErrStateNotFound
 	}
@@ -39,13 +57,132 @@ func (r *RedisRateLimitRepository) Save(ctx context.Context, state ratelimit.Sta
 	if err != nil {
 		return err
 	}
-	return r.client.Set(ctx, state.Key, body)
+	return r.client.Set(ctx, RedisKey(state.Key), body)
 }
 
+// ListKeys returns the keys holding a state. Keys derived from them, such as
+// quota counters, are left out.
 func (r *RedisRateLimitRepository) ListKeys(ctx context.Context) ([]string, error) {
-	return r.client.Keys(ctx, "*")
+	tagged, err := r.client.Keys(ctx, "{*}")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(tagged))
+	for _, raw := range tagged {
+		if key, ok := redisTagKey(raw); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// MigrateLegacyKeys moves the states saved under bare keys, as releases
+// before hash tags did, to their tagged key. Entries that are not states of
+// their own key are left alone, and a tagged state already present wins. It
+// returns how many states were moved.
+func (r *RedisRateLimitRepository) MigrateLegacyKeys(ctx context.Context) (int, error) {
+	candidates, err := r.client.Keys(ctx, "*")
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, key := range candidates {
+		if strings.HasPrefix(key, "{") {
+			continue
+		}
+		raw, err := r.client.Client.Get(ctx, key).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || strings.HasPrefix(err.Error(), "WRONGTYPE") {
+				continue
+			}
+			return moved, err
+		}
+		var state ratelimit.State
+		if json.Unmarshal([]byte(raw), &state) != nil || state.Key != key {
+			continue
+		}
+
+		if err := r.client.Client.SetNX(ctx, RedisKey(key), raw, 0).Err(); err != nil {
+			return moved, err
+		}
+		if err := r.client.Del(ctx, key); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
 }
 
 func (r *RedisRateLimitRepository) Delete(ctx context.Context, key string) error {
-	return r.client.Del(ctx, key)
+	return r.client.Del(ctx, RedisKey(key))
+}
+
+func (r *RedisRateLimitRepository) Increment(ctx context.Context, key string, delta int) (ratelimit.State, error) {
+	raw, err := incrementScript.Run(ctx, r.client.Client, []string{RedisKey(key)}, key, delta).Text()
+	if err != nil {
+		return ratelimit.State{}, err
+	}
+
+	var state ratelimit.State
+	if err := json.Unmarshal([]byte(raw), &state); err != nil {
+		return ratelimit.State{}, err
+	}
+	return state, nil
+}
+
+// IncrementAll applies every delta in a single pipeline, reading the keys
+// whose delta is zero. As with Run, increments the server has no cached
+// script for are retried with EVAL.
+func (r *RedisRateLimitRepository) IncrementAll(ctx context.Context, deltas map[string]int) (map[string]ratelimit.State, error) {
+	states := make(map[string]ratelimit.State, len(deltas))
+	uncached, err := r.incrementAll(ctx, deltas, states, incrementScript.EvalSha)
+	if err == nil && len(uncached) > 0 {
+		_, err = r.incrementAll(ctx, uncached, states, incrementScript.Eval)
+	}
+	return states, err
+}
+
+// incrementAll runs one pipeline, storing the states it gets back. It returns
+// the deltas whose script was missing from the server's cache.
+func (r *RedisRateLimitRepository) incrementAll(ctx context.Context, deltas map[string]int, states map[string]ratelimit.State, eval func(context.Context, redis.Scripter, []string, ...interface{}) *redis.Cmd) (map[string]int, error) {
+	pipe := r.client.Client.Pipeline()
+	replies := make(map[string]func() (string, error), len(deltas))
+	for key, delta := range deltas {
+		if delta > 0 {
+			replies[key] = eval(ctx, pipe, []string{RedisKey(key)}, key, delta).Text
+		} else {
+			replies[key] = pipe.Get(ctx, RedisKey(key)).Result
+		}
+	}
+	// Every reply carries its own error, which is checked below.
+	pipe.Exec(ctx)
+
+	var uncached map[string]int
+	var failed error
+	for key, reply := range replies {
+		raw, err := reply()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
+			if uncached == nil {
+				uncached = make(map[string]int)
+			}
+			uncached[key] = deltas[key]
+			continue
+		}
+		if err == nil {
+			var state ratelimit.State
+			if err = json.Unmarshal([]byte(raw), &state); err == nil {
+				states[key] = state
+				continue
+			}
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+	return uncached, failed
 }
@@ -2,24 +2,87 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
 type RedisClient struct {
-	Client *redis.Client
+	Client redis.UniversalClient
+}
+
+type RedisOptions struct {
+	Mode             string
+	Addrs            []string
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int
+	TLSConfig        *tls.Config
 }
 
 func NewRedisClient(ctx context.Context, addr, password string, db int) (RedisClient, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
+	return NewUniversalRedisClient(ctx, RedisOptions{
+		Mode:     RedisModeSingle,
+		Addrs:    []string{addr},
 		Password: password,
 		DB:       db,
 	})
+}
+
+func NewUniversalRedisClient(ctx context.Context, opts RedisOptions) (RedisClient, error) {
+	if len(opts.Addrs) == 0 {
+		return RedisClient{}, fmt.Errorf("redis: at least one address is required")
+	}
+
+	var client redis.UniversalClient
+	switch opts.Mode {
+	case "", RedisModeSingle:
+		client = redis.NewClient(&redis.Options{
+			Addr:      opts.Addrs[0],
+			Username:  opts.Username,
+			Password:  opts.Password,
+			DB:        opts.DB,
+			TLSConfig: opts.TLSConfig,
+		})
+	case RedisModeSentinel:
+		if opts.MasterName == "" {
+			return RedisClient{}, fmt.Errorf("redis: sentinel mode requires a master name")
+		}
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.MasterName,
+			SentinelAddrs:    opts.Addrs,
+			SentinelPassword: opts.SentinelPassword,
+			Username:         opts.Username,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			TLSConfig:        opts.TLSConfig,
+		})
+	case RedisModeCluster:
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     opts.Addrs,
+			Username:  opts.Username,
+			Password:  opts.Password,
+			TLSConfig: opts.TLSConfig,
+		})
+	default:
+		return RedisClient{}, fmt.Errorf("redis: unsupported mode %q", opts.Mode)
+	}
 
 	var err error
 	_, err = client.Ping(ctx).Result()
 	if err != nil {
+		_ = client.Close()
 		return RedisClient{}, err
 	}
 
@@ -28,25 +91,77 @@ func NewRedisClient(ctx context.Context, addr, password string, db int) (RedisCl
 	}, nil
 }
 
+// redisTagEscaper keeps "}" out of hash tags, where it would end the tag
+// early and split the keys of one client across slots.
+var (
+	redisTagEscaper   = strings.NewReplacer("%", "%25", "}", "%7D")
+	redisTagUnescaper = strings.NewReplacer("%25", "%", "%7D", "}")
+)
+
+// RedisKey wraps key in a cluster hash tag so that every key derived from it
+// (for example "{ip}:quota") hashes to the same slot and can be used together
+// in one Lua script. "%" and "}" are percent-encoded inside the tag.
+func RedisKey(key string, suffixes ...string) string {
+	tagged := "{" + redisTagEscaper.Replace(key) + "}"
+	if len(suffixes) == 0 {
+		return tagged
+	}
+	return tagged + ":" + strings.Join(suffixes, ":")
+}
+
+// redisTagKey returns the key wrapped by RedisKey in tagged, which must not
+// have suffixes.
+func redisTagKey(tagged string) (string, bool) {
+	inner, ok := strings.CutPrefix(tagged, "{")
+	if !ok {
+		return "", false
+	}
+	inner, ok = strings.CutSuffix(inner, "}")
+	if !ok || strings.Contains(inner, "}") {
+		return "", false
+	}
+	return redisTagUnescaper.Replace(inner), true
+}
+
 func (r *RedisClient) Get(ctx context.Context, ip string) (string, error) {
 	result, err := r.Client.Get(ctx, ip).Result()
 	if err == redis.Nil {
 		return "", ErrNotFound
 	}
 	return result, err
-
 }
 
 func (r *RedisClient) Set(ctx context.Context, ip string, json []byte) error {
 	return r.Client.Set(ctx, ip, json, 0).Err()
-
 }
 
+// Keys returns the keys matching pattern. In cluster mode the keyspace is
+// spread over every master, so each one is queried.
 func (r *RedisClient) Keys(ctx context.Context, pattern string) ([]string, error) {
-	return r.Client.Keys(ctx, pattern).Result()
+	cluster, ok := r.Client.(*redis.ClusterClient)
+	if !ok {
+		return r.Client.Keys(ctx, pattern).Result()
+	}
 
+	var mu sync.Mutex
+	keys := make([]string, 0)
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := node.Keys(ctx, pattern).Result()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
 }
 
 func (r *RedisClient) Del(ctx context.Context, key string) error {
 	return r.Client.Del(ctx, key).Err()
 }
+
+func (r *RedisClient) Close() error {
+	return r.Client.Close()
+}
@@ -106,3 +106,184 @@ func TestRedisRateLimitRepository(t *testing.T) {
 		t.Fatalf("expected ports.ErrStateNotFound, got %v", err)
 	}
 }
+
+func TestRedisKey_EscapesHashTag(t *testing.T) {
+	if key := RedisKey("a}b%7D", "quota"); key != "{a%7Db%257D}:quota" {
+		t.Fatalf("unexpected key %q", key)
+	}
+	if key, ok := redisTagKey(RedisKey("a}b%7D")); !ok || key != "a}b%7D" {
+		t.Fatalf("expected the key to round-trip, got %q (%v)", key, ok)
+	}
+}
+
+func TestRedisRateLimitRepository_ListKeysSkipsDerivedKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	client, err := NewRedisClient(ctx, mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	repo := NewRedisRateLimitRepository(&client)
+	_ = repo.Save(ctx, ratelimit.State{Key: "header:x-client-id=a}b"})
+	_ = client.Set(ctx, RedisKey("10.0.0.1", "penalty"), []byte("1"))
+
+	keys, err := repo.ListKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0] != "header:x-client-id=a}b" {
+		t.Fatalf("expected only the state key, got %v, %v", keys, err)
+	}
+}
+
+func TestRedisRateLimitRepository_MigrateLegacyKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	client, err := NewRedisClient(ctx, mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+	defer client.Close()
+
+	_ = client.Set(ctx, "10.0.0.1", []byte(`{"key":"10.0.0.1","count":4,"blocked_at":0}`))
+	_ = client.Set(ctx, "unrelated", []byte("value"))
+	_, _ = mr.SAdd("set", "member")
+
+	repo := NewRedisRateLimitRepository(&client)
+	moved, err := repo.MigrateLegacyKeys(ctx)
+	if err != nil || moved != 1 {
+		t.Fatalf("expected one state to be moved, got %d, %v", moved, err)
+	}
+	if state, err := repo.Get(ctx, "10.0.0.1"); err != nil || state.Count != 4 {
+		t.Fatalf("expected the legacy state under its tagged key, got %+v, %v", state, err)
+	}
+	if mr.Exists("10.0.0.1") || !mr.Exists("unrelated") || !mr.Exists("set") {
+		t.Fatalf("expected only the legacy state to move, got keys %v", mr.Keys())
+	}
+}
+
+func TestRedisRateLimitRepository_Increment(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	client, err := NewRedisClient(ctx, mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+
+	repo := NewRedisRateLimitRepository(&client)
+	if err := repo.Save(ctx, ratelimit.State{Key: "127.0.0.1", Count: 2, BlockedAt: 1700000000}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	state, err := repo.Increment(ctx, "127.0.0.1", 3)
+	if err != nil {
+		t.Fatalf("increment failed: %v", err)
+	}
+
+	expected := ratelimit.State{Key: "127.0.0.1", Count: 5, BlockedAt: 1700000000}
+	if state != expected {
+		t.Fatalf("expected state %#v, got %#v", expected, state)
+	}
+
+	state, err = repo.Increment(ctx, "10.0.0.1", 4)
+	if err != nil {
+		t.Fatalf("increment of missing key failed: %v", err)
+	}
+
+	if state.Key != "10.0.0.1" || state.Count != 4 {
+		t.Fatalf("expected new state with count 4, got %#v", state)
+	}
+}
+
+func TestRedisRateLimitRepository_IncrementAll(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	client, err := NewRedisClient(ctx, mr.Addr(), "", 0)
+	if err != nil {
+		t.Fatalf("expected client creation success, got %v", err)
+	}
+
+	repo := NewRedisRateLimitRepository(&client)
+	if err := repo.Save(ctx, ratelimit.State{Key: "127.0.0.1", Count: 2}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// The script is not cached yet, so the increments go through EVAL.
+	states, err := repo.IncrementAll(ctx, map[string]int{"127.0.0.1": 0, "10.0.0.1": 4, "10.0.0.2": 0})
+	if err != nil {
+		t.Fatalf("increment failed: %v", err)
+	}
+	if len(states) != 2 || states["127.0.0.1"].Count != 2 || states["10.0.0.1"].Count != 4 {
+		t.Fatalf("unexpected states %#v", states)
+	}
+
+	states, err = repo.IncrementAll(ctx, map[string]int{"127.0.0.1": 1, "10.0.0.1": 1})
+	if err != nil {
+		t.Fatalf("increment failed: %v", err)
+	}
+	if states["127.0.0.1"].Count != 3 || states["10.0.0.1"].Count != 5 {
+		t.Fatalf("unexpected states %#v", states)
+	}
+}
+
+func TestRedisKey_UsesHashTag(t *testing.T) {
+	if key := RedisKey("127.0.0.1"); key != "{127.0.0.1}" {
+		t.Fatalf("expected {127.0.0.1}, got %s", key)
+	}
+
+	if key := RedisKey("127.0.0.1", "quota", "day"); key != "{127.0.0.1}:quota:day" {
+		t.Fatalf("expected {127.0.0.1}:quota:day, got %s", key)
+	}
+}
+
+func TestNewUniversalRedisClient_ClusterMode(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	client, err := NewUniversalRedisClient(ctx, RedisOptions{Mode: RedisModeCluster, Addrs: []string{mr.Addr()}})
+	if err != nil {
+		t.Fatalf("expected cluster client creation success, got %v", err)
+	}
+
+	repo := NewRedisRateLimitRepository(&client)
+	if err := repo.Save(ctx, ratelimit.State{Key: "127.0.0.1", Count: 1}); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	keys, err := repo.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("list keys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "127.0.0.1" {
+		t.Fatalf("expected [127.0.0.1], got %v", keys)
+	}
+}
+
+func TestNewUniversalRedisClient_InvalidOptions(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewUniversalRedisClient(ctx, RedisOptions{Mode: RedisModeSentinel, Addrs: []string{"127.0.0.1:0"}}); err == nil {
+		t.Fatal("expected error for sentinel mode without master name")
+	}
+
+	if _, err := NewUniversalRedisClient(ctx, RedisOptions{Mode: "unknown", Addrs: []string{"127.0.0.1:0"}}); err == nil {
+		t.Fatal("expected error for unsupported mode")
+	}
+
+	if _, err := NewUniversalRedisClient(ctx, RedisOptions{}); err == nil {
+		t.Fatal("expected error when no address is configured")
+	}
+}
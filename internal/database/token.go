@@ -1,8 +1,11 @@
 package database
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
 )
 
 type TokenLimit struct {
@@ -11,9 +14,13 @@ type TokenLimit struct {
 }
 
 type TokenLimitList struct {
-	List map[string]TokenLimit
+	List    map[string]TokenLimit
+	Tenants map[string]string
 }
 
+// NewTokenLimitList reads a comma separated list of limits, each naming the
+// token "Token<limit>" ("20,50") unless it is given a name:
+// "partner=1000".
 func NewTokenLimitList(limitsParam string) (limitList TokenLimitList) {
 	limitList.List = make(map[string]TokenLimit)
 	if strings.TrimSpace(limitsParam) == "" {
@@ -26,16 +33,28 @@ func NewTokenLimitList(limitsParam string) (limitList TokenLimitList) {
 			continue
 		}
 
+		token := "Token" + value
+		if name, limit, ok := strings.Cut(value, "="); ok {
+			token, value = strings.TrimSpace(name), strings.TrimSpace(limit)
+		}
 		limite, err := strconv.Atoi(value)
-		if err != nil {
+		if err != nil || token == "" {
 			continue
 		}
-		token := "Token" + value
 		limitList.List[token] = TokenLimit{Name: token, Limit: limite}
 	}
 	return limitList
 }
 
+// AddTiers reads the limits of JWT tiers, "free=10,pro=1000", and keeps them
+// under their tier token, out of reach of any API key.
+func (tll *TokenLimitList) AddTiers(spec string) {
+	for name, tier := range NewTokenLimitList(spec).List {
+		token := ratelimit.TierToken(name)
+		tll.List[token] = TokenLimit{Name: token, Limit: tier.Limit}
+	}
+}
+
 func (tll *TokenLimitList) GetLimit(token string) int {
 	limite := tll.List[token].Limit
 	return limite
@@ -44,3 +63,26 @@ func (tll *TokenLimitList) GetLimit(token string) int {
 func (tll *TokenLimitList) LimitFor(token string) int {
 	return tll.GetLimit(token)
 }
+
+func (tll *TokenLimitList) TenantFor(token string) string {
+	return tll.Tenants[token]
+}
+
+// ParseTokenTenants reads a comma separated list of token=tenant pairs:
+// "Token20=acme,Token50=acme,Token100=globex".
+func ParseTokenTenants(spec string) (map[string]string, error) {
+	tenants := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		token, tenant, ok := strings.Cut(entry, "=")
+		token, tenant = strings.TrimSpace(token), strings.TrimSpace(tenant)
+		if !ok || token == "" || tenant == "" {
+			return nil, fmt.Errorf("invalid token tenant %q: expected token=tenant", entry)
+		}
+		tenants[token] = tenant
+	}
+	return tenants, nil
+}
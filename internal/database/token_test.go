@@ -29,3 +29,48 @@ func TestNewTokenLimitList_IgnoresInvalidValues(t *testing.T) {
 		t.Fatalf("expected invalid token to be ignored, got %d", tokens.GetLimit("Tokenabc"))
 	}
 }
+
+func TestNewTokenLimitList_ParsesNamedTiers(t *testing.T) {
+	tokens := NewTokenLimitList("20, pro=1000,free=abc")
+
+	if tokens.GetLimit("Token20") != 20 {
+		t.Fatalf("expected Token20 limit to be 20, got %d", tokens.GetLimit("Token20"))
+	}
+
+	if tokens.GetLimit("pro") != 1000 {
+		t.Fatalf("expected pro limit to be 1000, got %d", tokens.GetLimit("pro"))
+	}
+
+	if tokens.GetLimit("free") != 0 {
+		t.Fatalf("expected invalid tier to be ignored, got %d", tokens.GetLimit("free"))
+	}
+}
+
+func TestTokenLimitList_AddTiers(t *testing.T) {
+	tokens := NewTokenLimitList("20")
+	tokens.AddTiers("free=10,pro=1000")
+
+	if tokens.GetLimit("tier:pro") != 1000 || tokens.GetLimit("tier:free") != 10 {
+		t.Fatalf("expected tiers under their tier token, got %v", tokens.List)
+	}
+	if tokens.GetLimit("pro") != 0 || tokens.GetLimit("Token20") != 20 {
+		t.Fatalf("expected tiers apart from the API keys, got %v", tokens.List)
+	}
+}
+
+func TestParseTokenTenants(t *testing.T) {
+	tenants, err := ParseTokenTenants("Token20=acme, Token50=acme,,Token100=globex")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tokens := NewTokenLimitList("20,50,100")
+	tokens.Tenants = tenants
+	if tokens.TenantFor("Token50") != "acme" || tokens.TenantFor("Token100") != "globex" || tokens.TenantFor("Token10") != "" {
+		t.Fatalf("unexpected tenants: %v", tenants)
+	}
+
+	if _, err := ParseTokenTenants("Token20"); err == nil {
+		t.Fatal("expected entry without tenant to be rejected")
+	}
+}
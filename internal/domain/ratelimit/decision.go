@@ -0,0 +1,27 @@
+package ratelimit
+
+import "time"
+
+// Decision is the verdict for one request. Limit and Remaining are expressed
+// in budget units, of which the request consumed Cost; for multi-window rules
+// they describe the most restrictive Window, or the shared Scope when a
+// tenant, key or global budget is the tightest. Quota, when set, is the most
+// restrictive long-horizon quota and QuotaExceeded tells a quota denial apart
+// from a rate-limit one. Penalized marks keys denied for producing too many
+// bad responses and Locked requests to an account locked after too many
+// failed logins. ShadowDenied reports that the request's shadow rule, in
+// dry-run mode, would have denied it.
+type Decision struct {
+	Allowed       bool
+	Limit         int
+	Remaining     int
+	Cost          int
+	Window        time.Duration
+	Scope         ScopeLevel
+	RetryAfter    time.Duration
+	Quota         *QuotaStatus
+	QuotaExceeded bool
+	Penalized     bool
+	Locked        bool
+	ShadowDenied  bool
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Escalation lengthens the block of keys that keep exceeding their limit.
+// Every block is a strike; the n-th strike in a row blocks for the base
+// duration times Multiplier^(n-1), capped at Max. Strikes are forgotten once
+// the key has stayed unblocked for Decay. A Multiplier below 2 disables it.
+type Escalation struct {
+	Multiplier int
+	Max        time.Duration
+	Decay      time.Duration
+}
+
+// BlockFor returns how long the strikes-th block in a row lasts.
+func (e Escalation) BlockFor(base time.Duration, strikes int) time.Duration {
+	block := base
+	for i := 1; i < strikes && e.Multiplier > 1; i++ {
+		if block > math.MaxInt64/time.Duration(e.Multiplier) {
+			block = math.MaxInt64
+		} else {
+			block *= time.Duration(e.Multiplier)
+		}
+		if e.Max > 0 && block >= e.Max {
+			return max(e.Max, base)
+		}
+	}
+	return block
+}
+
+// Remembers reports whether a block released at releaseAt still counts as a
+// strike at now.
+func (e Escalation) Remembers(releaseAt, now time.Time) bool {
+	return now.Before(releaseAt.Add(e.Decay))
+}
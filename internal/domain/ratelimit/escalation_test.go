@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEscalationBlockFor_MultipliesUpToMax(t *testing.T) {
+	escalation := Escalation{Multiplier: 2, Max: 5 * time.Minute}
+
+	cases := map[int]time.Duration{
+		0: 30 * time.Second,
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute,
+		9: 5 * time.Minute,
+	}
+	for strikes, expected := range cases {
+		if got := escalation.BlockFor(30*time.Second, strikes); got != expected {
+			t.Fatalf("expected %s for %d strikes, got %s", expected, strikes, got)
+		}
+	}
+
+	if got := (Escalation{}).BlockFor(30*time.Second, 5); got != 30*time.Second {
+		t.Fatalf("expected fixed block without multiplier, got %s", got)
+	}
+}
+
+func TestEscalationRemembers_ForgetsAfterDecay(t *testing.T) {
+	escalation := Escalation{Multiplier: 2, Decay: time.Hour}
+	releaseAt := time.Unix(1700000000, 0)
+
+	if !escalation.Remembers(releaseAt, releaseAt.Add(59*time.Minute)) {
+		t.Fatal("expected strike to be remembered within the decay window")
+	}
+	if escalation.Remembers(releaseAt, releaseAt.Add(time.Hour)) {
+		t.Fatal("expected strike to be forgotten after the decay window")
+	}
+}
@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"strings"
+	"time"
+)
+
+// Lockout protects accounts against password guessing: once MaxFailures
+// logins of an account fail within Window, the account is locked for
+// Duration whichever IPs the attempts come from. A login fails when its
+// response has one of FailureStatuses.
+type Lockout struct {
+	MaxFailures     int
+	Window          time.Duration
+	Duration        time.Duration
+	FailureStatuses []int
+}
+
+// Failed reports whether a login answered with status failed.
+func (l Lockout) Failed(status int) bool {
+	for _, failure := range l.FailureStatuses {
+		if failure == status {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountKey is the key failed logins of account are counted under. Accounts
+// are compared case-insensitively.
+func AccountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
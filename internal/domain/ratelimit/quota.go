@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+// Quota is a long-horizon budget counted over a calendar period, on top of
+// the short-term rate limit. Tokens overrides Limit for specific API tokens.
+type Quota struct {
+	Period Period         `json:"period"`
+	Limit  int            `json:"limit"`
+	Tokens map[string]int `json:"tokens,omitempty"`
+}
+
+// QuotaStatus reports the usage of one quota after a request.
+type QuotaStatus struct {
+	Period    Period
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+func (q Quota) Validate() error {
+	if q.Period != PeriodDay && q.Period != PeriodMonth {
+		return fmt.Errorf("invalid quota period %q", q.Period)
+	}
+	if q.Limit <= 0 {
+		return fmt.Errorf("quota limit must be positive, got %d", q.Limit)
+	}
+	return nil
+}
+
+func (q Quota) LimitFor(token string) int {
+	if limit := q.Tokens[token]; limit > 0 {
+		return limit
+	}
+	return q.Limit
+}
+
+// Window returns an identifier of the calendar period containing now, as seen
+// in loc, and the instant that period ends.
+func (p Period) Window(now time.Time, loc *time.Location) (string, time.Time) {
+	local := now.In(loc)
+	year, month, day := local.Date()
+	if p == PeriodMonth {
+		start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		return string(p) + ":" + start.Format("2006-01"), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	return string(p) + ":" + start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
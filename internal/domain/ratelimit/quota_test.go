@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodWindow_AlignsToCalendarInLocation(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	// 02:30 UTC on Nov 1st is still Oct 31st in São Paulo.
+	now := time.Date(2026, time.November, 1, 2, 30, 0, 0, time.UTC)
+
+	id, resetAt := PeriodDay.Window(now, saoPaulo)
+	if id != "day:2026-10-31" || !resetAt.Equal(time.Date(2026, time.November, 1, 0, 0, 0, 0, saoPaulo)) {
+		t.Fatalf("unexpected daily window %s until %s", id, resetAt)
+	}
+
+	id, resetAt = PeriodMonth.Window(now, saoPaulo)
+	if id != "month:2026-10" || !resetAt.Equal(time.Date(2026, time.November, 1, 0, 0, 0, 0, saoPaulo)) {
+		t.Fatalf("unexpected monthly window %s until %s", id, resetAt)
+	}
+
+	id, _ = PeriodMonth.Window(now, time.UTC)
+	if id != "month:2026-11" {
+		t.Fatalf("expected UTC month to have rolled over, got %s", id)
+	}
+}
+
+func TestQuota_ValidateAndLimitFor(t *testing.T) {
+	quota := Quota{Period: PeriodMonth, Limit: 1000, Tokens: map[string]int{"Token100": 5000}}
+	if err := quota.Validate(); err != nil {
+		t.Fatalf("expected valid quota, got %v", err)
+	}
+	if quota.LimitFor("Token100") != 5000 || quota.LimitFor("") != 1000 {
+		t.Fatal("unexpected token limits")
+	}
+
+	if err := (Quota{Period: "week", Limit: 1}).Validate(); err == nil {
+		t.Fatal("expected unsupported period to be rejected")
+	}
+	if err := (Quota{Period: PeriodDay}).Validate(); err == nil {
+		t.Fatal("expected zero limit to be rejected")
+	}
+}
@@ -0,0 +1,28 @@
+package ratelimit
+
+import "time"
+
+type ScopeLevel string
+
+const (
+	ScopeGlobal ScopeLevel = "global"
+	ScopeTenant ScopeLevel = "tenant"
+	ScopeKey    ScopeLevel = "key"
+)
+
+// Scope is a budget shared by every request of a level above the client IP:
+// the whole service, the tenant owning the API key or the API key itself.
+// Overrides sets the limit of specific tenants or keys.
+type Scope struct {
+	Level     ScopeLevel
+	Limit     int
+	Duration  time.Duration
+	Overrides map[string]int
+}
+
+func (s Scope) LimitFor(id string) int {
+	if limit := s.Overrides[id]; limit > 0 {
+		return limit
+	}
+	return s.Limit
+}
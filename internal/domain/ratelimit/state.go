@@ -2,10 +2,15 @@ package ratelimit
 
 import "time"
 
+// State is the budget consumed by a key in the current window. Count is the
+// sum of the costs of the allowed requests, not the number of requests.
+// BlockedAt is the start of the last block and Strikes how many blocks in a
+// row led to it.
 type State struct {
 	Key       string `json:"key"`
 	Count     int    `json:"count"`
 	BlockedAt int64  `json:"blocked_at"`
+	Strikes   int    `json:"strikes"`
 }
 
 func NewState(key string) State {
@@ -16,6 +21,9 @@ func (s State) IsBlocked(now time.Time, blockDuration time.Duration) bool {
 	if s.BlockedAt <= 0 {
 		return false
 	}
-	releaseAt := time.Unix(s.BlockedAt, 0).Add(blockDuration)
-	return now.Before(releaseAt)
+	return now.Before(s.ReleaseAt(blockDuration))
+}
+
+func (s State) ReleaseAt(blockDuration time.Duration) time.Time {
+	return time.Unix(s.BlockedAt, 0).Add(blockDuration)
 }
@@ -0,0 +1,22 @@
+package ratelimit
+
+import "strings"
+
+// TierTokenPrefix marks the token of a client authenticated by a JWT, whose
+// limits are those of its tier: "tier:pro". Token limits and the tokens of
+// policy windows and quotas name tiers this way.
+const TierTokenPrefix = "tier:"
+
+// TierToken returns the token the limits of tier are looked up with.
+func TierToken(tier string) string {
+	return TierTokenPrefix + tier
+}
+
+// ClientToken returns the API key a client sent, or "" when the key poses as
+// a tier token, which only a verified JWT may select.
+func ClientToken(apiKey string) string {
+	if strings.HasPrefix(apiKey, TierTokenPrefix) {
+		return ""
+	}
+	return apiKey
+}
@@ -0,0 +1,12 @@
+package ratelimit
+
+import "testing"
+
+func TestClientToken_RejectsTierTokens(t *testing.T) {
+	if ClientToken("Token20") != "Token20" {
+		t.Fatal("expected API keys to pass through")
+	}
+	if ClientToken(TierToken("pro")) != "" {
+		t.Fatal("expected an API key posing as a tier to be dropped")
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"strconv"
+	"time"
+)
+
+// Window is one fixed-window limit of a rule, such as 300 requests per
+// minute. Windows are aligned to the Unix epoch and Tokens overrides Limit
+// for specific API tokens.
+type Window struct {
+	Limit    int
+	Duration time.Duration
+	Tokens   map[string]int
+}
+
+// Request describes what a single request asks of the limiter. Requests that
+// name a rule with windows are counted against those windows instead of the
+// default limit. Account and Lockout are set for login attempts. Shadow,
+// when set, describes a rule in dry-run mode, evaluated next to the request
+// but never enforced. Identity is set for authenticated clients.
+type Request struct {
+	Key      string
+	Token    string
+	Cost     int
+	Rule     string
+	Windows  []Window
+	Account  string
+	Lockout  *Lockout
+	Shadow   *Request
+	Identity Identity
+}
+
+// Identity is who a request authenticated as. Subject, when set, replaces
+// the API key as the key scope and Tenant the tenant of the token.
+type Identity struct {
+	Subject string
+	Tenant  string
+}
+
+func (w Window) LimitFor(token string) int {
+	if limit := w.Tokens[token]; limit > 0 {
+		return limit
+	}
+	return w.Limit
+}
+
+// Bucket returns the counter name of the window containing now for rule and
+// the instant that window ends. Windows start at multiples of the duration
+// since the Unix epoch; time.Truncate would align them to the zero time.
+func (w Window) Bucket(rule string, now time.Time) (string, time.Time) {
+	nanos := now.UnixNano()
+	start := time.Unix(0, nanos-nanos%int64(w.Duration))
+	name := "window:" + rule + ":" + w.Duration.String() + ":" + strconv.FormatInt(start.Unix(), 10)
+	return name, start.Add(w.Duration)
+}
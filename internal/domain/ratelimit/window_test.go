@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowBucket_AlignsToEpoch(t *testing.T) {
+	window := Window{Limit: 300, Duration: time.Minute}
+	now := time.Unix(1700000075, 0)
+
+	name, resetAt := window.Bucket("search", now)
+	if name != "window:search:1m0s:1700000040" {
+		t.Fatalf("unexpected bucket name %q", name)
+	}
+	if resetAt.Unix() != 1700000100 {
+		t.Fatalf("expected window to end at 1700000100, got %d", resetAt.Unix())
+	}
+
+	if window.LimitFor("any") != 300 {
+		t.Fatal("expected default window limit")
+	}
+}
+
+func TestWindowBucket_AlignsUnevenDurationsToEpoch(t *testing.T) {
+	window := Window{Limit: 10, Duration: 7 * time.Minute}
+	now := time.Unix(1700000075, 0)
+
+	name, resetAt := window.Bucket("search", now)
+	if name != "window:search:7m0s:1699999980" {
+		t.Fatalf("unexpected bucket name %q", name)
+	}
+	if resetAt.Unix() != 1700000400 {
+		t.Fatalf("expected window to end at 1700000400, got %d", resetAt.Unix())
+	}
+}
@@ -0,0 +1,269 @@
+// Package jwt verifies the bearer tokens clients identify themselves with.
+// Only the HS256, RS256 and ES256 algorithms are accepted, against keys
+// configured locally: no external service is ever called.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrAlgorithm = errors.New("unsupported token algorithm")
+	ErrSignature = errors.New("invalid token signature")
+	ErrExpired   = errors.New("token expired")
+	ErrNotYet    = errors.New("token not valid yet")
+)
+
+// Claims is the decoded payload of a token.
+type Claims map[string]any
+
+// String returns a string or numeric claim as text, or "".
+func (c Claims) String(name string) string {
+	switch v := c[name].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// ClaimMapping names the claims holding who the client is, the tenant it
+// belongs to and the tier whose limits apply, "sub", "org" and "plan" by
+// default.
+type ClaimMapping struct {
+	Subject string
+	Tenant  string
+	Tier    string
+}
+
+// Identify maps verified claims to a rate-limit identity and tier.
+func (m ClaimMapping) Identify(claims Claims) (ratelimit.Identity, string) {
+	identity := ratelimit.Identity{
+		Subject: claims.String(or(m.Subject, "sub")),
+		Tenant:  claims.String(or(m.Tenant, "org")),
+	}
+	return identity, claims.String(or(m.Tier, "plan"))
+}
+
+type verificationKey struct {
+	id     string
+	secret []byte
+	public crypto.PublicKey
+}
+
+// Verifier checks token signatures against its keys and rejects expired
+// tokens. Only the keys whose id matches the "kid" of the token are tried.
+type Verifier struct {
+	keys []verificationKey
+	now  func() time.Time
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{now: time.Now}
+}
+
+// AddSecret accepts HS256 tokens signed with secret.
+func (v *Verifier) AddSecret(secret []byte) {
+	v.keys = append(v.keys, verificationKey{secret: secret})
+}
+
+// AddPublicKey accepts RS256 or ES256 tokens signed by the private half of
+// key, an *rsa.PublicKey or a P-256 *ecdsa.PublicKey.
+func (v *Verifier) AddPublicKey(id string, key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return errors.New("only P-256 ECDSA keys are supported")
+		}
+	default:
+		return errors.New("unsupported public key type")
+	}
+	v.keys = append(v.keys, verificationKey{id: id, public: key})
+	return nil
+}
+
+// Verify checks the signature and validity period of token and returns its
+// claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	exp, err := claims.time("exp")
+	if err != nil {
+		return nil, err
+	}
+	nbf, err := claims.time("nbf")
+	if err != nil {
+		return nil, err
+	}
+	now := v.now()
+	if !exp.IsZero() && !now.Before(exp) {
+		return nil, ErrExpired
+	}
+	if !nbf.IsZero() && now.Before(nbf) {
+		return nil, ErrNotYet
+	}
+	return claims, nil
+}
+
+// time reads a NumericDate claim. A claim that is present but not a number
+// makes the token malformed rather than valid forever.
+func (c Claims) time(name string) (time.Time, error) {
+	value, ok := c[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+	seconds, ok := value.(float64)
+	if !ok {
+		return time.Time{}, ErrMalformed
+	}
+	return time.Unix(int64(seconds), 0), nil
+}
+
+func (v *Verifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	switch alg {
+	case "HS256", "RS256", "ES256":
+	default:
+		return ErrAlgorithm
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+	for _, key := range v.candidates(alg, kid) {
+		if verifyWith(alg, key, signed, digest[:], signature) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
+
+// candidates returns the keys of the algorithm family named by kid, keys
+// without an id answering to tokens without one. A lone key of the family is
+// used whatever the kid, so forged tokens can never make the verifier try the
+// whole key set.
+func (v *Verifier) candidates(alg, kid string) []verificationKey {
+	var named, family []verificationKey
+	for _, key := range v.keys {
+		if !key.supports(alg) {
+			continue
+		}
+		family = append(family, key)
+		if key.id == kid {
+			named = append(named, key)
+		}
+	}
+	if len(named) == 0 && len(family) == 1 {
+		return family
+	}
+	return named
+}
+
+func (k verificationKey) supports(alg string) bool {
+	switch alg {
+	case "HS256":
+		return k.secret != nil
+	case "RS256":
+		_, ok := k.public.(*rsa.PublicKey)
+		return ok
+	case "ES256":
+		_, ok := k.public.(*ecdsa.PublicKey)
+		return ok
+	}
+	return false
+}
+
+// verifyWith only uses key for the algorithm family it belongs to, so an
+// RSA public key can never be abused as an HMAC secret.
+func verifyWith(alg string, key verificationKey, signed string, digest, signature []byte) bool {
+	switch alg {
+	case "HS256":
+		if key.secret == nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS256":
+		public, ok := key.public.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(public, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		public, ok := key.public.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(public, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, into any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(raw, into); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the verified claims of the
+// request.
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the verified claims stored by NewContext.
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,170 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func sign(t *testing.T, alg, kid string, claims map[string]any, key any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestVerifier() *Verifier {
+	verifier := NewVerifier()
+	verifier.now = func() time.Time { return testNow }
+	return verifier
+}
+
+func TestVerify_HS256(t *testing.T) {
+	verifier := newTestVerifier()
+	verifier.AddSecret([]byte("secret"))
+
+	claims, err := verifier.Verify(sign(t, "HS256", "", map[string]any{"sub": "alice", "exp": testNow.Unix() + 60}, []byte("secret")))
+	if err != nil || claims.String("sub") != "alice" {
+		t.Fatalf("expected valid token, got %v, %v", claims, err)
+	}
+
+	cases := map[string]struct {
+		token string
+		err   error
+	}{
+		"wrong secret": {sign(t, "HS256", "", map[string]any{"sub": "alice"}, []byte("other")), ErrSignature},
+		"expired":      {sign(t, "HS256", "", map[string]any{"exp": testNow.Unix()}, []byte("secret")), ErrExpired},
+		"not yet":      {sign(t, "HS256", "", map[string]any{"nbf": testNow.Unix() + 60}, []byte("secret")), ErrNotYet},
+		"text exp":     {sign(t, "HS256", "", map[string]any{"exp": "never"}, []byte("secret")), ErrMalformed},
+		"null nbf":     {sign(t, "HS256", "", map[string]any{"nbf": nil}, []byte("secret")), ErrMalformed},
+		"alg none":     {sign(t, "none", "", map[string]any{"sub": "alice"}, []byte("secret")), ErrAlgorithm},
+		"malformed":    {"not-a-token", ErrMalformed},
+	}
+	for name, tc := range cases {
+		if _, err := verifier.Verify(tc.token); !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestVerify_RS256FromPEM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	verifier := newTestVerifier()
+	if err := verifier.AddPEM(public); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := verifier.Verify(sign(t, "RS256", "", map[string]any{"sub": "alice"}, key)); err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	// A token "signed" with the public key as an HMAC secret must not pass.
+	if _, err := verifier.Verify(sign(t, "HS256", "", map[string]any{"sub": "alice"}, public)); !errors.Is(err, ErrSignature) {
+		t.Fatalf("expected algorithm confusion to be rejected, got %v", err)
+	}
+	if err := verifier.AddPEM([]byte("nothing here")); err == nil {
+		t.Fatal("expected error for PEM without keys")
+	}
+}
+
+func TestVerify_ES256FromJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := func(kid string, k *ecdsa.PrivateKey) string {
+		x := base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, 32)))
+		y := base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, 32)))
+		return fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":%q,"x":%q,"y":%q}`, kid, x, y)
+	}
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","crv":"P-384","kid":"skipped"},%s,%s]}`, jwk("a", key), jwk("b", other))
+
+	verifier := newTestVerifier()
+	if err := verifier.AddJWKS([]byte(jwks)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := verifier.Verify(sign(t, "ES256", "a", map[string]any{"sub": "alice"}, key)); err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	if _, err := verifier.Verify(sign(t, "ES256", "b", map[string]any{"sub": "alice"}, key)); !errors.Is(err, ErrSignature) {
+		t.Fatalf("expected token naming another key to be rejected, got %v", err)
+	}
+	if _, err := verifier.Verify(sign(t, "ES256", "", map[string]any{"sub": "alice"}, key)); !errors.Is(err, ErrSignature) {
+		t.Fatalf("expected token without kid not to be tried against every key, got %v", err)
+	}
+
+	if err := verifier.AddJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AA","y":"AA"}]}`)); err == nil {
+		t.Fatal("expected error for invalid EC key")
+	}
+	if err := verifier.AddJWKS([]byte(`{"keys":[{"kty":"oct","kid":"empty","k":""}]}`)); err == nil {
+		t.Fatal("expected error for oct key without secret")
+	}
+	if err := verifier.AddJWKS([]byte(`{"keys":[]}`)); err == nil {
+		t.Fatal("expected error for JWKS without usable keys")
+	}
+}
+
+func TestClaimMapping_Identify(t *testing.T) {
+	claims := Claims{"sub": "alice", "org": "acme", "plan": "pro", "tier": float64(2)}
+
+	identity, tier := ClaimMapping{}.Identify(claims)
+	if identity.Subject != "alice" || identity.Tenant != "acme" || tier != "pro" {
+		t.Fatalf("unexpected default mapping: %#v %q", identity, tier)
+	}
+
+	identity, tier = ClaimMapping{Subject: "org", Tenant: "missing", Tier: "tier"}.Identify(claims)
+	if identity.Subject != "acme" || identity.Tenant != "" || tier != "2" {
+		t.Fatalf("unexpected custom mapping: %#v %q", identity, tier)
+	}
+}
@@ -0,0 +1,154 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// AddPEM accepts tokens signed by the public keys or certificates in raw.
+func (v *Verifier) AddPEM(raw []byte) error {
+	added := 0
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+
+		var key any
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", block.Type, err)
+		}
+		if err := v.AddPublicKey("", key); err != nil {
+			return err
+		}
+		added++
+	}
+	if added == 0 {
+		return errors.New("no public keys found")
+	}
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// AddJWKS accepts tokens signed by the keys of a JSON Web Key Set. Keys for
+// encryption and of unsupported types are skipped.
+func (v *Verifier) AddJWKS(raw []byte) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	added := 0
+	for _, key := range set.Keys {
+		if key.Use == "enc" {
+			continue
+		}
+		switch key.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return fmt.Errorf("invalid JWKS key %q: %w", key.Kid, err)
+			}
+			if len(secret) == 0 {
+				return fmt.Errorf("invalid JWKS key %q: empty secret", key.Kid)
+			}
+			v.keys = append(v.keys, verificationKey{id: key.Kid, secret: secret})
+		case "RSA":
+			public, err := key.rsa()
+			if err != nil {
+				return fmt.Errorf("invalid JWKS key %q: %w", key.Kid, err)
+			}
+			v.keys = append(v.keys, verificationKey{id: key.Kid, public: public})
+		case "EC":
+			if key.Crv != "P-256" {
+				continue
+			}
+			public, err := key.ecdsa()
+			if err != nil {
+				return fmt.Errorf("invalid JWKS key %q: %w", key.Kid, err)
+			}
+			v.keys = append(v.keys, verificationKey{id: key.Kid, public: public})
+		default:
+			continue
+		}
+		added++
+	}
+	if added == 0 {
+		return errors.New("no usable keys in JWKS")
+	}
+	return nil
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (k jwk) ecdsa() (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != 32 || len(y) != 32 {
+		return nil, errors.New("invalid P-256 coordinates")
+	}
+	// ecdh rejects points that are not on the curve.
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
@@ -0,0 +1,223 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/jwt"
+)
+
+// KeyExtractor derives the rate-limit key of a request. ok is false when the
+// request lacks what the extractor looks for, e.g. a missing header.
+type KeyExtractor interface {
+	Extract(r *http.Request) (key string, ok bool)
+}
+
+// KeyExtractorFunc adapts a function to KeyExtractor.
+type KeyExtractorFunc func(r *http.Request) (string, bool)
+
+func (f KeyExtractorFunc) Extract(r *http.Request) (string, bool) {
+	return f(r)
+}
+
+// ClientIP keys requests by the address of the connecting client.
+func ClientIP() KeyExtractor {
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		return ip, err == nil && ip != ""
+	})
+}
+
+// Header keys requests by the value of a request header. The value is chosen
+// by the client, which gets a fresh budget for every value it makes up; combine
+// it with ClientIP when the header is not set by a trusted gateway.
+func Header(name string) KeyExtractor {
+	return labelled("header:"+strings.ToLower(name), func(r *http.Request) string {
+		return r.Header.Get(name)
+	})
+}
+
+// Cookie keys requests by the value of a cookie, which the client chooses just
+// like a header.
+func Cookie(name string) KeyExtractor {
+	return labelled("cookie:"+name, func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	})
+}
+
+// Query keys requests by a query string parameter, which the client chooses
+// just like a header.
+func Query(name string) KeyExtractor {
+	return labelled("query:"+name, func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	})
+}
+
+// Path keys requests by their URL path.
+func Path() KeyExtractor {
+	return labelled("path", func(r *http.Request) string {
+		return r.URL.Path
+	})
+}
+
+// ClientCertSubject keys requests by the common name of the verified TLS
+// client certificate.
+func ClientCertSubject() KeyExtractor {
+	return ClientCert(CertSubject)
+}
+
+// CertField is the part of a client certificate that identifies the client.
+type CertField string
+
+const (
+	// CertSubject is the common name of the certificate subject.
+	CertSubject CertField = "subject"
+	// CertSAN is the first DNS name, email address, URI or IP address the
+	// certificate was issued for.
+	CertSAN CertField = "san"
+	// CertFingerprint is the hex SHA-256 digest of the certificate.
+	CertFingerprint CertField = "fingerprint"
+)
+
+func ParseCertField(name string) (CertField, error) {
+	switch field := CertField(strings.ToLower(strings.TrimSpace(name))); field {
+	case CertSubject, CertSAN, CertFingerprint:
+		return field, nil
+	}
+	return "", fmt.Errorf("invalid certificate field %q", name)
+}
+
+// Of returns the field of cert, or "" when cert has none.
+func (f CertField) Of(cert *x509.Certificate) string {
+	switch f {
+	case CertSubject:
+		return cert.Subject.CommonName
+	case CertSAN:
+		switch {
+		case len(cert.DNSNames) > 0:
+			return cert.DNSNames[0]
+		case len(cert.EmailAddresses) > 0:
+			return cert.EmailAddresses[0]
+		case len(cert.URIs) > 0:
+			return cert.URIs[0].String()
+		case len(cert.IPAddresses) > 0:
+			return cert.IPAddresses[0].String()
+		}
+	case CertFingerprint:
+		sum := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// ClientCert keys requests by field of the TLS client certificate, provided
+// the server verified it against its CA bundle.
+func ClientCert(field CertField) KeyExtractor {
+	return labelled("cert:"+string(field), func(r *http.Request) string {
+		return ClientCertField(r, field)
+	})
+}
+
+// ClientCertField returns field of the verified TLS client certificate of r,
+// or "" when r has none.
+func ClientCertField(r *http.Request, field CertField) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return field.Of(r.TLS.VerifiedChains[0][0])
+}
+
+// JWTClaim keys requests by a claim of the bearer token verified by the
+// middleware. Tokens are never decoded without verification, so requests
+// fall back to their IP when JWT verification is not enabled.
+func JWTClaim(claim string) KeyExtractor {
+	return labelled("jwt:"+claim, func(r *http.Request) string {
+		claims, ok := jwt.FromContext(r.Context())
+		if !ok {
+			return ""
+		}
+		return claims.String(claim)
+	})
+}
+
+// keyEscaper percent-encodes the separator of composite keys, so that a part
+// holding "|" cannot forge the key of another combination of parts.
+var keyEscaper = strings.NewReplacer("%", "%25", "|", "%7C")
+
+// Composite keys requests by every part at once, e.g. client IP and path. It
+// fails when any part does.
+func Composite(parts ...KeyExtractor) KeyExtractor {
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		keys := make([]string, 0, len(parts))
+		for _, part := range parts {
+			key, ok := part.Extract(r)
+			if !ok {
+				return "", false
+			}
+			keys = append(keys, keyEscaper.Replace(key))
+		}
+		return strings.Join(keys, "|"), true
+	})
+}
+
+// ParseKeyExtractor builds an extractor from its policy form: "ip", "path",
+// "cert", "cert:<field>", "header:<name>", "cookie:<name>", "query:<name>" or "jwt:<claim>",
+// joined with "+" to combine them, as in "ip+path".
+func ParseKeyExtractor(spec string) (KeyExtractor, error) {
+	specs := strings.Split(spec, "+")
+	parts := make([]KeyExtractor, 0, len(specs))
+	for _, part := range specs {
+		kind, arg, _ := strings.Cut(strings.TrimSpace(part), ":")
+		var extractor KeyExtractor
+		switch {
+		case kind == "ip" && arg == "":
+			extractor = ClientIP()
+		case kind == "path" && arg == "":
+			extractor = Path()
+		case kind == "cert" && arg == "":
+			extractor = ClientCertSubject()
+		case kind == "cert":
+			field, err := ParseCertField(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q", part)
+			}
+			extractor = ClientCert(field)
+		case kind == "header" && arg != "":
+			extractor = Header(arg)
+		case kind == "cookie" && arg != "":
+			extractor = Cookie(arg)
+		case kind == "query" && arg != "":
+			extractor = Query(arg)
+		case kind == "jwt" && arg != "":
+			extractor = JWTClaim(arg)
+		default:
+			return nil, fmt.Errorf("invalid key %q", part)
+		}
+		parts = append(parts, extractor)
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return Composite(parts...), nil
+}
+
+// labelled prefixes extracted values with their source so that, say, a
+// header holding an IP address never shares a counter with that IP.
+func labelled(label string, value func(r *http.Request) string) KeyExtractor {
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		v := value(r)
+		if v == "" {
+			return "", false
+		}
+		return label + "=" + v, true
+	})
+}
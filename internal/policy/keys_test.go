@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xavierpms/rate-limiter/internal/jwt"
+)
+
+func TestParseKeyExtractor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search?client=mobile", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Client-Id", "acme")
+	r = r.WithContext(jwt.NewContext(r.Context(), jwt.Claims{"sub": "user-1", "org": float64(42)}))
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s3cr3t"})
+	billing := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{billing}, VerifiedChains: [][]*x509.Certificate{{billing}}}
+
+	cases := map[string]string{
+		"ip":                 "10.0.0.1",
+		"path":               "path=/search",
+		"header:X-Client-Id": "header:x-client-id=acme",
+		"cookie:session":     "cookie:session=s3cr3t",
+		"query:client":       "query:client=mobile",
+		"jwt:sub":            "jwt:sub=user-1",
+		"jwt:org":            "jwt:org=42",
+		"cert":               "cert:subject=billing",
+		"ip+path":            "10.0.0.1|path=/search",
+	}
+	for spec, expected := range cases {
+		extractor, err := ParseKeyExtractor(spec)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", spec, err)
+		}
+		if key, ok := extractor.Extract(r); !ok || key != expected {
+			t.Fatalf("%s: expected key %q, got %q (%v)", spec, expected, key, ok)
+		}
+	}
+
+	for _, spec := range []string{"", "header", "ip:1", "ip+", "session"} {
+		if _, err := ParseKeyExtractor(spec); err == nil {
+			t.Fatalf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestJWTClaim_IgnoresUnverifiedTokens(t *testing.T) {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+	r := httptest.NewRequest(http.MethodGet, "/search", nil)
+	r.Header.Set("Authorization", "Bearer header."+claims+".signature")
+
+	if key, ok := JWTClaim("sub").Extract(r); ok {
+		t.Fatalf("expected unverified claims to be ignored, got %q", key)
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	cert := &x509.Certificate{
+		Raw:      []byte("der"),
+		Subject:  pkix.Name{CommonName: "partner-a", Organization: []string{"Acme"}},
+		DNSNames: []string{"partner-a.example.com"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	extractor, err := ParseKeyExtractor("cert:subject")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := extractor.Extract(r); ok {
+		t.Fatal("expected unverified certificates to be ignored")
+	}
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	sum := sha256.Sum256(cert.Raw)
+	cases := map[string]string{
+		"cert:subject":     "cert:subject=partner-a",
+		"cert:san":         "cert:san=partner-a.example.com",
+		"cert:fingerprint": "cert:fingerprint=" + hex.EncodeToString(sum[:]),
+	}
+	for spec, expected := range cases {
+		extractor, err := ParseKeyExtractor(spec)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", spec, err)
+		}
+		if key, ok := extractor.Extract(r); !ok || key != expected {
+			t.Fatalf("%s: expected key %q, got %q (%v)", spec, expected, key, ok)
+		}
+	}
+
+	if _, err := ParseKeyExtractor("cert:issuer"); err == nil {
+		t.Fatal("expected error for unknown certificate field")
+	}
+}
+
+func TestRule_KeyFallsBackToIP(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[{"name":"partners","key":"header:X-Client-Id+path"}]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if key := p.Match(r).KeyOf(r, "10.0.0.1"); key != "10.0.0.1" {
+		t.Fatalf("expected fallback to the IP, got %q", key)
+	}
+
+	r.Header.Set("X-Client-Id", "acme")
+	if key := p.Match(r).KeyOf(r, "10.0.0.1"); key != "header:x-client-id=acme|path=/orders" {
+		t.Fatalf("unexpected key %q", key)
+	}
+
+	if _, err := Parse([]byte(`{"rules":[{"name":"x","key":"body:user"}]}`)); err == nil {
+		t.Fatal("expected invalid key error")
+	}
+}
+
+func TestComposite_EscapesSeparator(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[{"name":"partners","key":"header:A+header:B"}]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	victim := httptest.NewRequest(http.MethodGet, "/", nil)
+	victim.Header.Set("A", "p")
+	victim.Header.Set("B", "q|header:b=r")
+
+	forged := httptest.NewRequest(http.MethodGet, "/", nil)
+	forged.Header.Set("A", "p|header:b=q")
+	forged.Header.Set("B", "r")
+
+	victimKey := p.Match(victim).KeyOf(victim, "10.0.0.1")
+	forgedKey := p.Match(forged).KeyOf(forged, "10.0.0.2")
+	if victimKey == forgedKey {
+		t.Fatalf("expected distinct keys, both got %q", victimKey)
+	}
+	if forgedKey != "header:a=p%7Cheader:b=q|header:b=r" {
+		t.Fatalf("unexpected key %q", forgedKey)
+	}
+}
@@ -0,0 +1,401 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+// defaultMaxCost caps the cost requests declare through a header or query
+// parameter when the rule sets no max_cost.
+const defaultMaxCost = 1000
+
+// Policy is the set of rules loaded from RATELIMIT_POLICY_FILE. Rules are
+// matched in file order and the first one that applies wins. Quotas apply to
+// every key, with periods aligned to the calendar of Timezone (UTC when empty).
+type Policy struct {
+	Timezone string            `json:"timezone,omitempty"`
+	Quotas   []ratelimit.Quota `json:"quotas,omitempty"`
+	Scopes   []Scope           `json:"scopes,omitempty"`
+	Rules    []Rule            `json:"rules"`
+
+	location  *time.Location
+	hierarchy []ratelimit.Scope
+}
+
+// Scope is a budget shared above the client IP by the whole service
+// ("global"), the tenant owning the API key ("tenant") or the key itself
+// ("key"). Overrides sets the limit of specific tenants or keys.
+type Scope struct {
+	Level     ratelimit.ScopeLevel `json:"level"`
+	Limit     int                  `json:"limit"`
+	Window    string               `json:"window"`
+	Overrides map[string]int       `json:"overrides,omitempty"`
+}
+
+type Rule struct {
+	Name       string   `json:"name"`
+	Host       string   `json:"host,omitempty"`
+	PathPrefix string   `json:"path_prefix,omitempty"`
+	Methods    []string `json:"methods,omitempty"`
+	// Cost is how many units of the budget a matching request consumes.
+	Cost int `json:"cost,omitempty"`
+	// CostHeader and CostQuery let the request declare a higher cost, for
+	// example the size of a batch. Values below Cost are ignored and values
+	// above MaxCost, 1000 by default, are capped.
+	CostHeader string `json:"cost_header,omitempty"`
+	CostQuery  string `json:"cost_query,omitempty"`
+	MaxCost    int    `json:"max_cost,omitempty"`
+	// Windows replace the default limit for matching requests with limits
+	// that must all hold at once, e.g. 20 per second and 300 per minute.
+	Windows []Window `json:"windows,omitempty"`
+	// Login makes the rule guard a login endpoint, locking accounts after
+	// too many failed attempts.
+	Login *Login `json:"login,omitempty"`
+	// Shadow evaluates the rule without enforcing it, to see who a new
+	// limit would hit before rolling it out.
+	Shadow bool `json:"shadow,omitempty"`
+	// Response customises the body and status of denied requests.
+	Response *Response `json:"response,omitempty"`
+	// Key picks what requests are counted by instead of the client IP, in
+	// the form accepted by ParseKeyExtractor, e.g. "header:X-Client-Id" or
+	// "ip+path". Requests lacking the key fall back to their IP.
+	Key string `json:"key,omitempty"`
+
+	windows   []ratelimit.Window
+	lockout   *ratelimit.Lockout
+	extractor KeyExtractor
+}
+
+// Login names the body field holding the account, a top-level JSON string or
+// a form field, and how many failed attempts within Window lock the account
+// for Lockout. A response with one of FailureStatuses (401 by default) is a
+// failed attempt.
+type Login struct {
+	Field           string `json:"field"`
+	MaxFailures     int    `json:"max_failures"`
+	Window          string `json:"window"`
+	Lockout         string `json:"lockout"`
+	FailureStatuses []int  `json:"failure_statuses,omitempty"`
+}
+
+// maxLoginBody bounds how much of a login request is read to find the
+// account; accounts of larger JSON bodies are not recognised.
+const maxLoginBody = 64 << 10
+
+type Window struct {
+	Limit int `json:"limit"`
+	// Window is a Go duration such as "1s", "1m" or "1h".
+	Window string         `json:"window"`
+	Tokens map[string]int `json:"tokens,omitempty"`
+}
+
+func Load(path string) (Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("read policy file: %w", err)
+	}
+	return Parse(raw)
+}
+
+func Parse(raw []byte) (Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Policy{}, fmt.Errorf("invalid policy file: %w", err)
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].normalize(); err != nil {
+			return Policy{}, err
+		}
+	}
+	for _, quota := range p.Quotas {
+		if err := quota.Validate(); err != nil {
+			return Policy{}, fmt.Errorf("invalid policy quota: %w", err)
+		}
+	}
+	for _, scope := range p.Scopes {
+		parsed, err := scope.parse()
+		if err != nil {
+			return Policy{}, err
+		}
+		p.hierarchy = append(p.hierarchy, parsed)
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return Policy{}, fmt.Errorf("invalid policy timezone: %w", err)
+	}
+	p.location = location
+	return p, nil
+}
+
+// Location is the time zone quota periods are aligned to.
+func (p Policy) Location() *time.Location {
+	if p.location == nil {
+		return time.UTC
+	}
+	return p.location
+}
+
+// Hierarchy returns the shared scopes every request consumes from.
+func (p Policy) Hierarchy() []ratelimit.Scope {
+	return p.hierarchy
+}
+
+// Match returns the first enforced rule applying to r, or nil. Shadow rules
+// are skipped, so a rule in dry-run mode never lifts the limits a request is
+// otherwise subject to.
+func (p Policy) Match(r *http.Request) *Rule {
+	return p.match(r, false)
+}
+
+// MatchShadow returns the first shadow rule applying to r, or nil.
+func (p Policy) MatchShadow(r *http.Request) *Rule {
+	return p.match(r, true)
+}
+
+func (p Policy) match(r *http.Request, shadow bool) *Rule {
+	for i := range p.Rules {
+		if p.Rules[i].Shadow == shadow && p.Rules[i].matches(r) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Request describes r to the limiter under the rule, which may be nil.
+func (rule *Rule) Request(r *http.Request, key, token string) ratelimit.Request {
+	req := ratelimit.Request{Key: key, Token: token, Cost: rule.CostOf(r)}
+	if rule != nil {
+		req.Rule = rule.Name
+		req.Windows = rule.windows
+		req.Lockout = rule.lockout
+	}
+	return req
+}
+
+// KeyOf returns the key r is counted by under the rule, or fallback when
+// the rule has no key or r lacks it.
+func (rule *Rule) KeyOf(r *http.Request, fallback string) string {
+	if rule == nil || rule.extractor == nil {
+		return fallback
+	}
+	if key, ok := rule.extractor.Extract(r); ok {
+		return key
+	}
+	return fallback
+}
+
+// CostOf returns the budget units r consumes under the rule; requests without
+// a rule cost 1.
+func (rule *Rule) CostOf(r *http.Request) int {
+	if rule == nil {
+		return 1
+	}
+
+	cost := rule.Cost
+	if rule.CostHeader != "" {
+		cost = max(cost, parseCost(r.Header.Get(rule.CostHeader)))
+	}
+	if rule.CostQuery != "" {
+		cost = max(cost, parseCost(r.URL.Query().Get(rule.CostQuery)))
+	}
+	limit := rule.MaxCost
+	if limit <= 0 {
+		limit = max(defaultMaxCost, rule.Cost)
+	}
+	return min(cost, limit)
+}
+
+func (rule *Rule) normalize() error {
+	if rule.Name == "" {
+		return fmt.Errorf("invalid policy rule: missing name")
+	}
+	if rule.Cost < 0 {
+		return fmt.Errorf("invalid policy rule %q: cost must not be negative", rule.Name)
+	}
+	if rule.Cost == 0 {
+		rule.Cost = 1
+	}
+	if rule.MaxCost != 0 && rule.MaxCost < rule.Cost {
+		return fmt.Errorf("invalid policy rule %q: max_cost must not be below cost", rule.Name)
+	}
+	rule.windows = make([]ratelimit.Window, 0, len(rule.Windows))
+	for _, window := range rule.Windows {
+		duration, err := time.ParseDuration(window.Window)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid policy rule %q: invalid window %q", rule.Name, window.Window)
+		}
+		if window.Limit <= 0 {
+			return fmt.Errorf("invalid policy rule %q: window limit must be positive", rule.Name)
+		}
+		rule.windows = append(rule.windows, ratelimit.Window{Limit: window.Limit, Duration: duration, Tokens: window.Tokens})
+	}
+	if rule.Key != "" {
+		extractor, err := ParseKeyExtractor(rule.Key)
+		if err != nil {
+			return fmt.Errorf("invalid policy rule %q: %w", rule.Name, err)
+		}
+		rule.extractor = extractor
+	}
+	if rule.Response != nil {
+		if err := rule.Response.parse(); err != nil {
+			return fmt.Errorf("invalid policy rule %q: %w", rule.Name, err)
+		}
+	}
+	if rule.Login != nil {
+		lockout, err := rule.Login.parse()
+		if err != nil {
+			return fmt.Errorf("invalid policy rule %q: %w", rule.Name, err)
+		}
+		rule.lockout = &lockout
+	}
+	rule.Host = strings.ToLower(rule.Host)
+	for i, method := range rule.Methods {
+		rule.Methods[i] = strings.ToUpper(method)
+	}
+	return nil
+}
+
+func (l *Login) parse() (ratelimit.Lockout, error) {
+	if l.Field == "" {
+		return ratelimit.Lockout{}, fmt.Errorf("missing login field")
+	}
+	if l.MaxFailures <= 0 {
+		return ratelimit.Lockout{}, fmt.Errorf("login max_failures must be positive")
+	}
+	window, err := time.ParseDuration(l.Window)
+	if err != nil || window <= 0 {
+		return ratelimit.Lockout{}, fmt.Errorf("invalid login window %q", l.Window)
+	}
+	lockout, err := time.ParseDuration(l.Lockout)
+	if err != nil || lockout <= 0 {
+		return ratelimit.Lockout{}, fmt.Errorf("invalid login lockout %q", l.Lockout)
+	}
+	statuses := l.FailureStatuses
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusUnauthorized}
+	}
+	return ratelimit.Lockout{MaxFailures: l.MaxFailures, Window: window, Duration: lockout, FailureStatuses: statuses}, nil
+}
+
+// AccountError explains why the account of a login attempt could not be
+// read, with the status the attempt should be answered with.
+type AccountError struct {
+	Status int
+	Reason string
+}
+
+func (e *AccountError) Error() string {
+	return e.Reason
+}
+
+// Account reads the login field from the body of r, which is put back for
+// the next handler. Attempts whose account cannot be read fail with an
+// *AccountError instead of going unguarded, so the lockout cannot be
+// sidestepped by changing the body or its content type.
+func (rule *Rule) Account(r *http.Request) (string, error) {
+	if rule == nil || rule.Login == nil {
+		return "", nil
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", &AccountError{Status: http.StatusBadRequest, Reason: "Missing login " + rule.Login.Field}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLoginBody+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return "", &AccountError{Status: http.StatusBadRequest, Reason: "Unreadable login body"}
+	}
+	if len(body) > maxLoginBody {
+		return "", &AccountError{Status: http.StatusRequestEntityTooLarge, Reason: "Login body too large"}
+	}
+
+	var account string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields[rule.Login.Field], &account) != nil {
+			account = ""
+		}
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			account = values.Get(rule.Login.Field)
+		}
+	default:
+		return "", &AccountError{Status: http.StatusUnsupportedMediaType, Reason: "Unsupported login content type"}
+	}
+	if strings.TrimSpace(account) == "" {
+		return "", &AccountError{Status: http.StatusBadRequest, Reason: "Missing login " + rule.Login.Field}
+	}
+	return account, nil
+}
+
+func (s Scope) parse() (ratelimit.Scope, error) {
+	switch s.Level {
+	case ratelimit.ScopeGlobal, ratelimit.ScopeTenant, ratelimit.ScopeKey:
+	default:
+		return ratelimit.Scope{}, fmt.Errorf("invalid policy scope: unknown level %q", s.Level)
+	}
+	duration, err := time.ParseDuration(s.Window)
+	if err != nil || duration <= 0 {
+		return ratelimit.Scope{}, fmt.Errorf("invalid policy scope %q: invalid window %q", s.Level, s.Window)
+	}
+	if s.Limit <= 0 {
+		return ratelimit.Scope{}, fmt.Errorf("invalid policy scope %q: limit must be positive", s.Level)
+	}
+	return ratelimit.Scope{Level: s.Level, Limit: s.Limit, Duration: duration, Overrides: s.Overrides}, nil
+}
+
+func (rule *Rule) matches(r *http.Request) bool {
+	if rule.Host != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.ToLower(host) != rule.Host {
+			return false
+		}
+	}
+	if rule.PathPrefix != "" && !HasPathPrefix(r.URL.Path, rule.PathPrefix) {
+		return false
+	}
+	if len(rule.Methods) > 0 {
+		for _, method := range rule.Methods {
+			if method == r.Method {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func parseCost(raw string) int {
+	cost, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || cost < 0 {
+		return 0
+	}
+	return cost
+}
+
+// HasPathPrefix reports whether path is prefix or lies below it, so that
+// "/api" matches "/api" and "/api/users" but not "/apix". Proxy routes match
+// their prefixes the same way.
+func HasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
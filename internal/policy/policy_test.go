@@ -0,0 +1,248 @@
+package policy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse_MatchesRulesInOrder(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[
+		{"name":"bulk","path_prefix":"/bulk","methods":["post"],"cost":100},
+		{"name":"reports","host":"Reports.Example.com","cost":10},
+		{"name":"api","path_prefix":"/"}
+	]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cases := []struct {
+		method, target, rule string
+		cost                 int
+	}{
+		{"POST", "http://api.example.com/bulk/import", "bulk", 100},
+		{"POST", "http://api.example.com/bulk", "bulk", 100},
+		{"POST", "http://api.example.com/bulkhead", "api", 1},
+		{"GET", "http://api.example.com/bulk/import", "api", 1},
+		{"GET", "http://reports.example.com:8443/monthly", "reports", 10},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		rule := p.Match(req)
+		if rule == nil || rule.Name != tc.rule {
+			t.Fatalf("%s %s: expected rule %q, got %+v", tc.method, tc.target, tc.rule, rule)
+		}
+		if cost := rule.CostOf(req); cost != tc.cost {
+			t.Fatalf("%s %s: expected cost %d, got %d", tc.method, tc.target, tc.cost, cost)
+		}
+	}
+}
+
+func TestRule_CostFromHeaderAndQuery(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[{"name":"batch","cost":5,"cost_header":"X-Batch-Size","cost_query":"count"}]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/batch?count=40", nil)
+	if cost := p.Match(req).CostOf(req); cost != 40 {
+		t.Fatalf("expected query cost 40, got %d", cost)
+	}
+
+	req = httptest.NewRequest("POST", "/batch", nil)
+	req.Header.Set("X-Batch-Size", "70")
+	if cost := p.Match(req).CostOf(req); cost != 70 {
+		t.Fatalf("expected header cost 70, got %d", cost)
+	}
+
+	req = httptest.NewRequest("POST", "/batch?count=1", nil)
+	if cost := p.Match(req).CostOf(req); cost != 5 {
+		t.Fatalf("expected declared cost to never go below the rule cost, got %d", cost)
+	}
+
+	req = httptest.NewRequest("POST", "/batch?count=9223372036854775807", nil)
+	if cost := p.Match(req).CostOf(req); cost != 1000 {
+		t.Fatalf("expected declared cost to be capped at 1000, got %d", cost)
+	}
+
+	p, err = Parse([]byte(`{"rules":[{"name":"batch","cost_header":"X-Batch-Size","max_cost":50}]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	req = httptest.NewRequest("POST", "/batch", nil)
+	req.Header.Set("X-Batch-Size", "70")
+	if cost := p.Match(req).CostOf(req); cost != 50 {
+		t.Fatalf("expected declared cost to be capped at max_cost, got %d", cost)
+	}
+}
+
+func TestMatch_NoRuleCostsOne(t *testing.T) {
+	req := httptest.NewRequest("GET", "/hello", nil)
+	if cost := (Policy{}).Match(req).CostOf(req); cost != 1 {
+		t.Fatalf("expected cost 1, got %d", cost)
+	}
+}
+
+func TestMatch_SkipsShadowRules(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[
+		{"name":"strict","path_prefix":"/search","shadow":true},
+		{"name":"search","path_prefix":"/search","cost":2}
+	]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/search", nil)
+	if rule := p.Match(r); rule == nil || rule.Name != "search" {
+		t.Fatalf("expected the enforced rule, got %#v", rule)
+	}
+	if rule := p.MatchShadow(r); rule == nil || rule.Name != "strict" {
+		t.Fatalf("expected the shadow rule, got %#v", rule)
+	}
+}
+
+func TestLoad_InvalidRules(t *testing.T) {
+	cases := map[string]string{
+		"missing name":        `{"rules":[{"path_prefix":"/"}]}`,
+		"negative cost":       `{"rules":[{"name":"x","cost":-1}]}`,
+		"max cost below cost": `{"rules":[{"name":"x","cost":5,"max_cost":2}]}`,
+		"invalid json":        `{"rules":`,
+		"login field":         `{"rules":[{"name":"x","login":{"max_failures":5,"window":"15m","lockout":"30m"}}]}`,
+		"login window":        `{"rules":[{"name":"x","login":{"field":"username","max_failures":5,"window":"soon","lockout":"30m"}}]}`,
+		"response":            `{"rules":[{"name":"x","response":{"detail":"{{.Limit"}}]}`,
+		"status":              `{"rules":[{"name":"x","response":{"status":200}}]}`,
+	}
+	for name, raw := range cases {
+		path := filepath.Join(t.TempDir(), "policy.json")
+		if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "read policy file") {
+		t.Fatalf("expected read error, got %v", err)
+	}
+}
+
+func TestParse_QuotasAndTimezone(t *testing.T) {
+	p, err := Parse([]byte(`{"timezone":"America/Sao_Paulo","quotas":[{"period":"month","limit":1000000,"tokens":{"Token100":5000000}}],"rules":[]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if p.Location().String() != "America/Sao_Paulo" {
+		t.Fatalf("unexpected location %s", p.Location())
+	}
+	if len(p.Quotas) != 1 || p.Quotas[0].LimitFor("Token100") != 5000000 {
+		t.Fatalf("unexpected quotas %#v", p.Quotas)
+	}
+
+	if (Policy{}).Location() != time.UTC {
+		t.Fatal("expected UTC by default")
+	}
+	if _, err := Parse([]byte(`{"timezone":"Mars/Olympus"}`)); err == nil {
+		t.Fatal("expected invalid timezone to be rejected")
+	}
+	if _, err := Parse([]byte(`{"quotas":[{"period":"year","limit":1}]}`)); err == nil {
+		t.Fatal("expected invalid quota to be rejected")
+	}
+}
+
+func TestRule_RequestCarriesWindows(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[{"name":"api","windows":[{"limit":20,"window":"1s"},{"limit":300,"window":"1m","tokens":{"Token100":1000}}]}]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	req := p.Match(r).Request(r, "10.0.0.1", "Token100")
+	if req.Rule != "api" || req.Key != "10.0.0.1" || req.Cost != 1 || len(req.Windows) != 2 {
+		t.Fatalf("unexpected request %#v", req)
+	}
+	if req.Windows[1].Duration != time.Minute || req.Windows[1].LimitFor("Token100") != 1000 {
+		t.Fatalf("unexpected window %#v", req.Windows[1])
+	}
+
+	if req := (Policy{}).Match(r).Request(r, "10.0.0.1", ""); req.Rule != "" || req.Windows != nil || req.Cost != 1 {
+		t.Fatalf("expected default request without a rule, got %#v", req)
+	}
+
+	for _, raw := range []string{
+		`{"rules":[{"name":"x","windows":[{"limit":1,"window":"soon"}]}]}`,
+		`{"rules":[{"name":"x","windows":[{"limit":0,"window":"1s"}]}]}`,
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestParse_Scopes(t *testing.T) {
+	p, err := Parse([]byte(`{"scopes":[
+		{"level":"global","limit":10000,"window":"1s"},
+		{"level":"tenant","limit":500,"window":"1s","overrides":{"acme":2000}}
+	],"rules":[]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	scopes := p.Hierarchy()
+	if len(scopes) != 2 || scopes[0].Duration != time.Second || scopes[1].LimitFor("acme") != 2000 || scopes[1].LimitFor("globex") != 500 {
+		t.Fatalf("unexpected scopes %#v", scopes)
+	}
+
+	if _, err := Parse([]byte(`{"scopes":[{"level":"region","limit":1,"window":"1s"}]}`)); err == nil {
+		t.Fatal("expected unknown level to be rejected")
+	}
+}
+
+func TestRule_AccountReadsLoginField(t *testing.T) {
+	p, err := Parse([]byte(`{"rules":[
+		{"name":"login","path_prefix":"/login","login":{"field":"username","max_failures":5,"window":"15m","lockout":"30m"}}
+	]}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cases := []struct {
+		contentType, body, account string
+		status                     int
+	}{
+		{"application/json", `{"username":"Alice","password":"x"}`, "Alice", 0},
+		{"application/json; charset=utf-8", `{"username":42}`, "", http.StatusBadRequest},
+		{"application/json", `{"username":`, "", http.StatusBadRequest},
+		{"application/x-www-form-urlencoded", "username=bob&password=x", "bob", 0},
+		{"application/x-www-form-urlencoded", "password=x", "", http.StatusBadRequest},
+		{"text/plain", "username=bob", "", http.StatusUnsupportedMediaType},
+		{"application/json", `{"username":"carol","padding":"` + strings.Repeat("x", maxLoginBody) + `"}`, "", http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+
+		rule := p.Match(r)
+		req := rule.Request(r, "10.0.0.1", "")
+		if req.Lockout == nil || req.Lockout.MaxFailures != 5 || req.Lockout.Duration != 30*time.Minute || !req.Lockout.Failed(401) {
+			t.Fatalf("unexpected lockout %+v", req.Lockout)
+		}
+
+		account, err := rule.Account(r)
+		var invalid *AccountError
+		if account != tc.account || tc.status == 0 && err != nil || tc.status != 0 && (!errors.As(err, &invalid) || invalid.Status != tc.status) {
+			t.Fatalf("%s %.20q: expected account %q and status %d, got %q, %v", tc.contentType, tc.body, tc.account, tc.status, account, err)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != tc.body {
+			t.Fatalf("%s: expected body to be restored, got %.20q", tc.contentType, body)
+		}
+	}
+}
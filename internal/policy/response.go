@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"text/template"
+)
+
+// Response customises what the denied requests of a rule receive. Detail is
+// a text/template and HTML, or the file at HTMLFile, an html/template for
+// browsers; both are rendered with a Denial. Status replaces 429 and Type
+// is the RFC 9457 problem type URI.
+type Response struct {
+	Status   int    `json:"status,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	HTML     string `json:"html,omitempty"`
+	HTMLFile string `json:"html_file,omitempty"`
+
+	detail *template.Template
+	html   *htmltemplate.Template
+}
+
+// Denial describes a denied request to the response templates. RetryAfter
+// and Window are in seconds.
+type Denial struct {
+	Rule       string
+	Status     int
+	Message    string
+	Limit      int
+	Remaining  int
+	Window     int
+	RetryAfter int
+}
+
+func (resp *Response) parse() error {
+	if resp.Status != 0 && (resp.Status < 400 || resp.Status > 599) {
+		return fmt.Errorf("invalid response status %d", resp.Status)
+	}
+	if resp.Detail != "" {
+		detail, err := template.New("detail").Parse(resp.Detail)
+		if err != nil {
+			return fmt.Errorf("invalid response detail: %w", err)
+		}
+		resp.detail = detail
+	}
+
+	page := resp.HTML
+	if resp.HTMLFile != "" {
+		raw, err := os.ReadFile(resp.HTMLFile)
+		if err != nil {
+			return fmt.Errorf("read response html: %w", err)
+		}
+		page = string(raw)
+	}
+	if page != "" {
+		html, err := htmltemplate.New("html").Parse(page)
+		if err != nil {
+			return fmt.Errorf("invalid response html: %w", err)
+		}
+		resp.html = html
+	}
+	return nil
+}
+
+// StatusOr returns the configured status, or fallback when there is none.
+func (resp *Response) StatusOr(fallback int) int {
+	if resp == nil || resp.Status == 0 {
+		return fallback
+	}
+	return resp.Status
+}
+
+// RenderDetail returns the detail of the denial, falling back to its message.
+func (resp *Response) RenderDetail(d Denial) string {
+	if resp == nil || resp.detail == nil {
+		return d.Message
+	}
+	var out bytes.Buffer
+	if err := resp.detail.Execute(&out, d); err != nil {
+		return d.Message
+	}
+	return out.String()
+}
+
+// HasHTML reports whether the rule serves a page to browsers.
+func (resp *Response) HasHTML() bool {
+	return resp != nil && resp.html != nil
+}
+
+// RenderHTML writes the page of the denial to w.
+func (resp *Response) RenderHTML(w io.Writer, d Denial) error {
+	return resp.html.Execute(w, d)
+}
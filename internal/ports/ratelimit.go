@@ -3,6 +3,7 @@ package ports
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
 )
@@ -19,3 +20,64 @@ type RateLimitStateRepository interface {
 type TokenLimitProvider interface {
 	LimitFor(token string) int
 }
+
+// TenantProvider is implemented by a TokenLimitProvider that also knows the
+// tenant owning each token. It is optional: without it requests only belong
+// to the tenant their verified identity names.
+type TenantProvider interface {
+	// TenantFor returns the tenant owning token, or "" when it has none.
+	TenantFor(token string) string
+}
+
+type RateLimitCounterRepository interface {
+	RateLimitStateRepository
+	Increment(ctx context.Context, key string, delta int) (ratelimit.State, error)
+}
+
+// RateLimitBatchCounter is implemented by counter stores that can apply many
+// deltas in a single round trip. It is optional: stores without it are
+// synced one key at a time.
+type RateLimitBatchCounter interface {
+	// IncrementAll adds each delta to its key and returns the resulting
+	// states; a zero delta only reads the key. Keys without a state are left
+	// out of the result. On error the result holds the keys that were applied.
+	IncrementAll(ctx context.Context, deltas map[string]int) (map[string]ratelimit.State, error)
+}
+
+// ConcurrencyRepository tracks the in-flight requests of a key. Each slot is
+// a lease that expires on its own, so slots held by a crashed replica are
+// eventually reclaimed.
+type ConcurrencyRepository interface {
+	Acquire(ctx context.Context, key, id string, limit int, lease time.Duration) (inFlight int, acquired bool, err error)
+	Release(ctx context.Context, key, id string) error
+}
+
+// QuotaBucket is one counter of a key that resets by expiring: a quota period
+// ("quota:month:2026-10") or a rule window ("window:search:1m0s:1700000040").
+type QuotaBucket struct {
+	Name     string
+	Limit    int
+	ExpireAt time.Time
+}
+
+// QuotaRepository keeps bucket counters apart from the rate-limit state so
+// that the periodic cleanup never resets them.
+type QuotaRepository interface {
+	// Consume adds cost to every bucket only if all of them stay within their
+	// limit. used holds each bucket's count after the call and exceeded the
+	// index of the first bucket that would overflow, or -1.
+	Consume(ctx context.Context, key string, cost int, buckets []QuotaBucket) (used []int, exceeded int, err error)
+}
+
+// PenaltyRepository counts the bad responses of a key and holds the keys it
+// sends to the penalty box. Counters and boxes expire on their own.
+type PenaltyRepository interface {
+	// Penalize counts one bad response in a window opened by the first one.
+	// Once threshold is reached the key is boxed for block and releaseAt is
+	// the end of the box; otherwise it is the zero time.
+	Penalize(ctx context.Context, key string, threshold int, window, block time.Duration) (releaseAt time.Time, err error)
+	// ReleaseAt returns when a boxed key is let out, or the zero time.
+	ReleaseAt(ctx context.Context, key string) (time.Time, error)
+	// Clear lets a boxed key out and forgets its bad responses.
+	Clear(ctx context.Context, key string) error
+}
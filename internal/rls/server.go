@@ -0,0 +1,104 @@
+package rls
+
+import (
+	"context"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/usecase"
+)
+
+type Limiter interface {
+	Check(key, token string) ratelimit.Decision
+}
+
+// CostLimiter is implemented by limiters able to honour the request's
+// hits_addend instead of counting every descriptor as one hit.
+type CostLimiter interface {
+	CheckCost(key, token string, cost int) ratelimit.Decision
+}
+
+// Server implements envoy.service.ratelimit.v3.RateLimitService on top of the
+// limiter, so Envoy can use this project as its global rate limit service.
+type Server struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+	limiter Limiter
+	unit    rlsv3.RateLimitResponse_RateLimit_Unit
+}
+
+// NewServer reports limits in the unit matching window, the interval after
+// which counters are reset, or UNKNOWN when it is not a whole unit.
+func NewServer(limiter Limiter, window time.Duration) *Server {
+	return &Server{limiter: limiter, unit: unitFor(window)}
+}
+
+func (s *Server) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	if req.GetDomain() == "" {
+		return nil, status.Error(codes.InvalidArgument, "rate limit domain must not be empty")
+	}
+	if len(req.GetDescriptors()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "rate limit descriptor list must not be empty")
+	}
+
+	resp := &rlsv3.RateLimitResponse{OverallCode: rlsv3.RateLimitResponse_OK}
+	for _, descriptor := range req.GetDescriptors() {
+		key, token := usecase.DescriptorKey(req.GetDomain(), descriptorEntries(descriptor))
+		decision := s.check(key, token, req.GetHitsAddend())
+
+		descriptorStatus := &rlsv3.RateLimitResponse_DescriptorStatus{
+			Code:           rlsv3.RateLimitResponse_OK,
+			LimitRemaining: uint32(max(decision.Remaining, 0)),
+		}
+		if decision.Limit > 0 {
+			descriptorStatus.CurrentLimit = &rlsv3.RateLimitResponse_RateLimit{
+				RequestsPerUnit: uint32(decision.Limit),
+				Unit:            s.unit,
+			}
+		}
+		if !decision.Allowed {
+			descriptorStatus.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+			if decision.RetryAfter > 0 {
+				descriptorStatus.DurationUntilReset = durationpb.New(decision.RetryAfter)
+			}
+		}
+		resp.Statuses = append(resp.Statuses, descriptorStatus)
+	}
+	return resp, nil
+}
+
+func (s *Server) check(key, token string, hits uint32) ratelimit.Decision {
+	if weighted, ok := s.limiter.(CostLimiter); ok && hits > 1 {
+		return weighted.CheckCost(key, token, int(hits))
+	}
+	return s.limiter.Check(key, token)
+}
+
+func descriptorEntries(descriptor *corev3.RateLimitDescriptor) []usecase.DescriptorEntry {
+	entries := make([]usecase.DescriptorEntry, 0, len(descriptor.GetEntries()))
+	for _, entry := range descriptor.GetEntries() {
+		entries = append(entries, usecase.DescriptorEntry{Key: entry.GetKey(), Value: entry.GetValue()})
+	}
+	return entries
+}
+
+func unitFor(window time.Duration) rlsv3.RateLimitResponse_RateLimit_Unit {
+	switch window {
+	case time.Second:
+		return rlsv3.RateLimitResponse_RateLimit_SECOND
+	case time.Minute:
+		return rlsv3.RateLimitResponse_RateLimit_MINUTE
+	case time.Hour:
+		return rlsv3.RateLimitResponse_RateLimit_HOUR
+	case 24 * time.Hour:
+		return rlsv3.RateLimitResponse_RateLimit_DAY
+	default:
+		return rlsv3.RateLimitResponse_RateLimit_UNKNOWN
+	}
+}
@@ -0,0 +1,151 @@
+package rls
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+type fakeLimiter struct {
+	decisions map[string]ratelimit.Decision
+	keys      []string
+	tokens    []string
+}
+
+func (f *fakeLimiter) Check(key, token string) ratelimit.Decision {
+	f.keys = append(f.keys, key)
+	f.tokens = append(f.tokens, token)
+	return f.decisions[key]
+}
+
+func descriptor(entries ...string) *corev3.RateLimitDescriptor {
+	d := &corev3.RateLimitDescriptor{}
+	for i := 0; i+1 < len(entries); i += 2 {
+		d.Entries = append(d.Entries, &corev3.RateLimitDescriptor_Entry{Key: entries[i], Value: entries[i+1]})
+	}
+	return d
+}
+
+func TestShouldRateLimit_OK(t *testing.T) {
+	limiter := &fakeLimiter{decisions: map[string]ratelimit.Decision{
+		"edge|remote_address=203.0.113.9|api_key=Token20": {Allowed: true, Limit: 20, Remaining: 12},
+	}}
+	server := NewServer(limiter, time.Second)
+
+	resp, err := server.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain:      "edge",
+		Descriptors: []*corev3.RateLimitDescriptor{descriptor("remote_address", "203.0.113.9", "api_key", "Token20")},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("expected OK, got %s", resp.GetOverallCode())
+	}
+
+	if limiter.tokens[0] != "Token20" {
+		t.Fatalf("expected api_key entry to select the token limit, got %q", limiter.tokens[0])
+	}
+
+	statusOK := resp.GetStatuses()[0]
+	if statusOK.GetLimitRemaining() != 12 || statusOK.GetCurrentLimit().GetRequestsPerUnit() != 20 {
+		t.Fatalf("unexpected descriptor status: %v", statusOK)
+	}
+
+	if statusOK.GetCurrentLimit().GetUnit() != rlsv3.RateLimitResponse_RateLimit_SECOND {
+		t.Fatalf("expected SECOND unit, got %s", statusOK.GetCurrentLimit().GetUnit())
+	}
+}
+
+func TestShouldRateLimit_OverLimitOnAnyDescriptor(t *testing.T) {
+	limiter := &fakeLimiter{decisions: map[string]ratelimit.Decision{
+		"edge|path=/hello":                {Allowed: true, Limit: 100, Remaining: 50},
+		"edge|remote_address=203.0.113.9": {Allowed: false, Limit: 10, RetryAfter: 3 * time.Second},
+	}}
+	server := NewServer(limiter, 1500*time.Millisecond)
+
+	resp, err := server.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain: "edge",
+		Descriptors: []*corev3.RateLimitDescriptor{
+			descriptor("path", "/hello"),
+			descriptor("remote_address", "203.0.113.9"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Fatalf("expected OVER_LIMIT, got %s", resp.GetOverallCode())
+	}
+
+	if len(resp.GetStatuses()) != 2 {
+		t.Fatalf("expected one status per descriptor, got %d", len(resp.GetStatuses()))
+	}
+
+	if resp.GetStatuses()[0].GetCode() != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("expected first descriptor OK, got %s", resp.GetStatuses()[0].GetCode())
+	}
+
+	overLimit := resp.GetStatuses()[1]
+	if overLimit.GetCode() != rlsv3.RateLimitResponse_OVER_LIMIT || overLimit.GetDurationUntilReset().AsDuration() != 3*time.Second {
+		t.Fatalf("unexpected over-limit status: %v", overLimit)
+	}
+
+	if overLimit.GetCurrentLimit().GetUnit() != rlsv3.RateLimitResponse_RateLimit_UNKNOWN {
+		t.Fatalf("expected UNKNOWN unit for a non-standard window, got %s", overLimit.GetCurrentLimit().GetUnit())
+	}
+}
+
+func TestShouldRateLimit_InvalidRequest(t *testing.T) {
+	server := NewServer(&fakeLimiter{}, time.Second)
+
+	_, err := server.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{Descriptors: []*corev3.RateLimitDescriptor{descriptor("k", "v")}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for empty domain, got %v", err)
+	}
+
+	_, err = server.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{Domain: "edge"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for empty descriptors, got %v", err)
+	}
+}
+
+type costLimiter struct {
+	fakeLimiter
+	costs []int
+}
+
+func (c *costLimiter) CheckCost(key, token string, cost int) ratelimit.Decision {
+	c.costs = append(c.costs, cost)
+	return ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 100 - cost, Cost: cost}
+}
+
+func TestShouldRateLimit_HonoursHitsAddend(t *testing.T) {
+	limiter := &costLimiter{}
+	server := NewServer(limiter, time.Second)
+
+	resp, err := server.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain:      "edge",
+		HitsAddend:  25,
+		Descriptors: []*corev3.RateLimitDescriptor{descriptor("remote_address", "203.0.113.9")},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(limiter.costs) != 1 || limiter.costs[0] != 25 {
+		t.Fatalf("expected a single check costing 25, got %v", limiter.costs)
+	}
+	if resp.GetStatuses()[0].GetLimitRemaining() != 75 {
+		t.Fatalf("unexpected descriptor status: %v", resp.GetStatuses()[0])
+	}
+}
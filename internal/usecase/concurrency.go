@@ -0,0 +1,68 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+type concurrencyLimit struct {
+	limit int
+	lease time.Duration
+	store ports.ConcurrencyRepository
+}
+
+// WithConcurrencyLimit caps how many requests of the same key may be in
+// flight at once. lease bounds how long a slot survives without being
+// released and should exceed the slowest legitimate request.
+func WithConcurrencyLimit(limit int, lease time.Duration, store ports.ConcurrencyRepository) Option {
+	return func(rl *RateLimiter) {
+		if limit > 0 && store != nil {
+			rl.concurrency = &concurrencyLimit{limit: limit, lease: lease, store: store}
+		}
+	}
+}
+
+// Acquire reserves an in-flight slot for ip. The returned release must be
+// called once the request completes; it is a no-op when the slot was denied
+// or no concurrency limit is configured.
+func (rl *RateLimiter) Acquire(ip, token string) (func(), ratelimit.Decision) {
+	if rl.concurrency == nil {
+		return func() {}, ratelimit.Decision{Allowed: true}
+	}
+
+	limit := rl.concurrency.limit
+	id, err := leaseID()
+	if err != nil {
+		log.Println("failed to generate lease id:", err)
+		return func() {}, rl.failureDecision(limit)
+	}
+
+	inFlight, acquired, err := rl.concurrency.store.Acquire(rl.ctx, ip, id, limit, rl.concurrency.lease)
+	if err != nil {
+		log.Println("failed to acquire concurrency slot:", err)
+		return func() {}, rl.failureDecision(limit)
+	}
+	if !acquired {
+		return func() {}, ratelimit.Decision{Allowed: false, Limit: limit}
+	}
+
+	release := func() {
+		if err := rl.concurrency.store.Release(rl.ctx, ip, id); err != nil {
+			log.Println("failed to release concurrency slot:", err)
+		}
+	}
+	return release, ratelimit.Decision{Allowed: true, Limit: limit, Remaining: limit - inFlight}
+}
+
+func leaseID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
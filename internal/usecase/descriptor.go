@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+// TokenDescriptorKey is the descriptor entry whose value is looked up in the
+// token limit list, mirroring the API_KEY header of the HTTP middleware.
+const TokenDescriptorKey = "api_key"
+
+type DescriptorEntry struct {
+	Key   string
+	Value string
+}
+
+// descriptorEscaper percent-encodes the separators of descriptor keys, so that
+// values holding "|" or "=" cannot forge the key of another descriptor.
+var descriptorEscaper = strings.NewReplacer("%", "%25", "|", "%7C", "=", "%3D")
+
+// DescriptorKey maps an Envoy style descriptor onto the limiter key model:
+// every distinct domain and entry list gets its own counter, and the
+// api_key entry, when present, selects the token limit.
+func DescriptorKey(domain string, entries []DescriptorEntry) (key, token string) {
+	var b strings.Builder
+	b.WriteString(descriptorEscaper.Replace(domain))
+	for _, entry := range entries {
+		b.WriteString("|")
+		b.WriteString(descriptorEscaper.Replace(entry.Key))
+		b.WriteString("=")
+		b.WriteString(descriptorEscaper.Replace(entry.Value))
+		if entry.Key == TokenDescriptorKey {
+			token = ratelimit.ClientToken(entry.Value)
+		}
+	}
+	return b.String(), token
+}
@@ -0,0 +1,32 @@
+package usecase
+
+import "testing"
+
+func TestDescriptorKey(t *testing.T) {
+	key, token := DescriptorKey("edge", []DescriptorEntry{
+		{Key: "remote_address", Value: "203.0.113.9"},
+		{Key: TokenDescriptorKey, Value: "Token20"},
+	})
+
+	if key != "edge|remote_address=203.0.113.9|api_key=Token20" {
+		t.Fatalf("unexpected key %q", key)
+	}
+
+	if token != "Token20" {
+		t.Fatalf("expected token Token20, got %q", token)
+	}
+
+	_, token = DescriptorKey("edge", []DescriptorEntry{{Key: "path", Value: "/hello"}})
+	if token != "" {
+		t.Fatalf("expected no token, got %q", token)
+	}
+
+	forged, _ := DescriptorKey("edge", []DescriptorEntry{{Key: "remote_address", Value: "203.0.113.9|api_key=Token20"}})
+	if forged != "edge|remote_address=203.0.113.9%7Capi_key%3DToken20" {
+		t.Fatalf("expected separators in values to be escaped, got %q", forged)
+	}
+	plain, _ := DescriptorKey("edge", []DescriptorEntry{{Key: "remote_address", Value: "203.0.113.9"}})
+	if spliced, _ := DescriptorKey("edge|remote_address=203.0.113.9", nil); spliced == plain {
+		t.Fatal("expected a domain holding separators not to collide with entries")
+	}
+}
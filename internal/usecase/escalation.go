@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+// WithEscalation lengthens the block of keys that are blocked again before
+// their previous strikes decay.
+func WithEscalation(escalation ratelimit.Escalation) Option {
+	return func(rl *RateLimiter) {
+		rl.escalation = escalation
+	}
+}
+
+// blockFor returns how long a key with the given strikes stays blocked.
+func (rl *RateLimiter) blockFor(strikes int) time.Duration {
+	return rl.escalation.BlockFor(rl.blockDuration, strikes)
+}
+
+// remembers reports whether the last block of state still matters at now,
+// either because it is in progress or because its strikes have not decayed.
+func (rl *RateLimiter) remembers(state ratelimit.State, now time.Time) bool {
+	if state.BlockedAt <= 0 {
+		return false
+	}
+	return rl.escalation.Remembers(state.ReleaseAt(rl.blockFor(state.Strikes)), now)
+}
+
+// strikes returns the blocks in a row of state that still count at now.
+func (rl *RateLimiter) strikes(state ratelimit.State, now time.Time) int {
+	if !rl.remembers(state, now) {
+		return 0
+	}
+	return state.Strikes
+}
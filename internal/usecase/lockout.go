@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+var errNoLockoutStore = errors.New("no lockout store configured")
+
+// WithLockoutStore sets where failed logins and locked accounts are kept.
+// Without it, login rules only apply their rate limits.
+func WithLockoutStore(store ports.PenaltyRepository) Option {
+	return func(rl *RateLimiter) {
+		rl.lockouts = store
+	}
+}
+
+// checkLockout denies logins to a locked account. The second result tells
+// whether the decision is final.
+func (rl *RateLimiter) checkLockout(req ratelimit.Request) (ratelimit.Decision, bool) {
+	releaseAt, err := rl.lockouts.ReleaseAt(rl.ctx, ratelimit.AccountKey(req.Account))
+	if err != nil {
+		log.Println("failed to check account lockout:", err)
+		return rl.failureDecision(0), !rl.failOpen
+	}
+
+	now := rl.now()
+	if !releaseAt.After(now) {
+		return ratelimit.Decision{}, false
+	}
+	return ratelimit.Decision{Allowed: false, RetryAfter: releaseAt.Sub(now), Locked: true}, true
+}
+
+// RecordLogin feeds the response status of a login attempt. A failed login
+// counts towards the lockout of its account and a successful one forgets the
+// failures before it.
+func (rl *RateLimiter) RecordLogin(req ratelimit.Request, status int) {
+	if rl.lockouts == nil || req.Lockout == nil || req.Account == "" {
+		return
+	}
+
+	key := ratelimit.AccountKey(req.Account)
+	if !req.Lockout.Failed(status) {
+		if status < 400 {
+			if err := rl.lockouts.Clear(rl.ctx, key); err != nil {
+				log.Println("failed to reset login failures:", err)
+			}
+		}
+		return
+	}
+
+	releaseAt, err := rl.lockouts.Penalize(rl.ctx, key, req.Lockout.MaxFailures, req.Lockout.Window, req.Lockout.Duration)
+	if err != nil {
+		log.Println("failed to record failed login:", err)
+		return
+	}
+	if !releaseAt.IsZero() {
+		log.Printf("account %q locked until %s", req.Account, releaseAt.Format(time.RFC3339))
+	}
+}
+
+// Unlock lifts the lockout of account and forgets its failed logins.
+func (rl *RateLimiter) Unlock(account string) error {
+	if rl.lockouts == nil {
+		return errNoLockoutStore
+	}
+	return rl.lockouts.Clear(rl.ctx, ratelimit.AccountKey(account))
+}
@@ -0,0 +1,9 @@
+package usecase
+
+type Option func(*RateLimiter)
+
+func WithFailOpen(failOpen bool) Option {
+	return func(rl *RateLimiter) {
+		rl.failOpen = failOpen
+	}
+}
@@ -0,0 +1,65 @@
+package usecase
+
+import (
+	"log"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+type penaltyBox struct {
+	statuses  map[int]bool
+	threshold int
+	window    time.Duration
+	block     time.Duration
+	store     ports.PenaltyRepository
+}
+
+// WithPenaltyBox blocks a key for block once threshold of its responses
+// within window had one of statuses, however slowly it sends requests.
+func WithPenaltyBox(statuses []int, threshold int, window, block time.Duration, store ports.PenaltyRepository) Option {
+	return func(rl *RateLimiter) {
+		if threshold <= 0 || len(statuses) == 0 || store == nil {
+			return
+		}
+		box := &penaltyBox{statuses: make(map[int]bool, len(statuses)), threshold: threshold, window: window, block: block, store: store}
+		for _, status := range statuses {
+			box.statuses[status] = true
+		}
+		rl.penalty = box
+	}
+}
+
+// Report feeds the status of a response sent to ip into its penalty
+// counter. Statuses outside the configured ones are ignored.
+func (rl *RateLimiter) Report(ip string, status int) {
+	if rl.penalty == nil || !rl.penalty.statuses[status] {
+		return
+	}
+
+	releaseAt, err := rl.penalty.store.Penalize(rl.ctx, ip, rl.penalty.threshold, rl.penalty.window, rl.penalty.block)
+	if err != nil {
+		log.Println("failed to record bad response:", err)
+		return
+	}
+	if !releaseAt.IsZero() {
+		log.Printf("key %s sent to the penalty box until %s", ip, releaseAt.Format(time.RFC3339))
+	}
+}
+
+// checkPenalty denies keys held in the penalty box. The second result tells
+// whether the decision is final.
+func (rl *RateLimiter) checkPenalty(ip string) (ratelimit.Decision, bool) {
+	releaseAt, err := rl.penalty.store.ReleaseAt(rl.ctx, ip)
+	if err != nil {
+		log.Println("failed to check penalty box:", err)
+		return rl.failureDecision(0), !rl.failOpen
+	}
+
+	now := rl.now()
+	if !releaseAt.After(now) {
+		return ratelimit.Decision{}, false
+	}
+	return ratelimit.Decision{Allowed: false, RetryAfter: releaseAt.Sub(now), Penalized: true}, true
+}
@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+type quotaLimit struct {
+	quotas   []ratelimit.Quota
+	location *time.Location
+}
+
+// WithQuotas adds daily or monthly budgets evaluated together with the rate
+// limit. Periods follow the calendar of location and the counters are kept
+// in store, which also becomes the bucket store of rule windows.
+func WithQuotas(quotas []ratelimit.Quota, location *time.Location, store ports.QuotaRepository) Option {
+	return func(rl *RateLimiter) {
+		if len(quotas) == 0 || store == nil {
+			return
+		}
+		if location == nil {
+			location = time.UTC
+		}
+		rl.quota = &quotaLimit{quotas: quotas, location: location}
+		rl.buckets = store
+	}
+}
+
+// WithBucketStore sets where the counters of multi-window rules are kept.
+// Without it, rules with windows fall back to the default limit.
+func WithBucketStore(store ports.QuotaRepository) Option {
+	return func(rl *RateLimiter) {
+		rl.buckets = store
+	}
+}
+
+func (rl *RateLimiter) quotaBuckets(token string, now time.Time) ([]ports.QuotaBucket, []ratelimit.QuotaStatus) {
+	buckets := make([]ports.QuotaBucket, len(rl.quota.quotas))
+	statuses := make([]ratelimit.QuotaStatus, len(rl.quota.quotas))
+	for i, quota := range rl.quota.quotas {
+		period, resetAt := quota.Period.Window(now, rl.quota.location)
+		limit := quota.LimitFor(token)
+		buckets[i] = ports.QuotaBucket{Name: "quota:" + period, Limit: limit, ExpireAt: resetAt}
+		statuses[i] = ratelimit.QuotaStatus{Period: quota.Period, Limit: limit, ResetAt: resetAt}
+	}
+	return buckets, statuses
+}
+
+// consumeQuota charges cost to every quota of the key.
+func (rl *RateLimiter) consumeQuota(ip, token string, cost int, now time.Time) (*ratelimit.QuotaStatus, bool, error) {
+	buckets, statuses := rl.quotaBuckets(token, now)
+	used, exceeded, err := rl.buckets.Consume(rl.ctx, ip, cost, buckets)
+	if err != nil {
+		return nil, false, err
+	}
+	return tightestQuota(statuses, used, exceeded), exceeded >= 0, nil
+}
+
+// tightestQuota reports the most restrictive quota: the exhausted one when
+// the request is denied, otherwise the one with the least remaining.
+func tightestQuota(statuses []ratelimit.QuotaStatus, used []int, exceeded int) *ratelimit.QuotaStatus {
+	for i := range statuses {
+		statuses[i].Remaining = max(statuses[i].Limit-used[i], 0)
+	}
+	if exceeded >= 0 {
+		return &statuses[exceeded]
+	}
+
+	tightest := &statuses[0]
+	for i := range statuses {
+		if statuses[i].Remaining < tightest.Remaining {
+			tightest = &statuses[i]
+		}
+	}
+	return tightest
+}
@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
@@ -11,17 +12,29 @@ import (
 
 type RateLimiter struct {
 	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
 	defaultLimit    int
 	cleanupInterval time.Duration
 	blockDuration   time.Duration
+	escalation      ratelimit.Escalation
 	tokenLimits     ports.TokenLimitProvider
 	store           ports.RateLimitStateRepository
+	failOpen        bool
+	concurrency     *concurrencyLimit
+	quota           *quotaLimit
+	penalty         *penaltyBox
+	lockouts        ports.PenaltyRepository
+	scopes          []ratelimit.Scope
+	buckets         ports.QuotaRepository
 	now             func() time.Time
 }
 
-func NewIpRateLimiter(ctx context.Context, limit int, interval time.Duration, blockInterval time.Duration, listTokens ports.TokenLimitProvider, store ports.RateLimitStateRepository) *RateLimiter {
+func NewIpRateLimiter(ctx context.Context, limit int, interval time.Duration, blockInterval time.Duration, listTokens ports.TokenLimitProvider, store ports.RateLimitStateRepository, opts ...Option) *RateLimiter {
+	ctx, cancel := context.WithCancel(ctx)
 	rl := &RateLimiter{
 		ctx:             ctx,
+		cancel:          cancel,
 		defaultLimit:    limit,
 		cleanupInterval: interval,
 		blockDuration:   blockInterval,
@@ -29,41 +42,94 @@ func NewIpRateLimiter(ctx context.Context, limit int, interval time.Duration, bl
 		store:           store,
 		now:             time.Now,
 	}
+	for _, opt := range opts {
+		opt(rl)
+	}
 	if interval > 0 {
+		rl.wg.Add(1)
 		go rl.cleanupLoop()
 	}
 	return rl
 }
 
+// Close stops the background cleanup loop and waits for it to return.
+func (rl *RateLimiter) Close() {
+	rl.cancel()
+	rl.wg.Wait()
+}
+
 func (rl *RateLimiter) Allow(ip, token string) bool {
+	return rl.Check(ip, token).Allowed
+}
+
+func (rl *RateLimiter) Check(ip, token string) ratelimit.Decision {
+	return rl.CheckCost(ip, token, 1)
+}
+
+func (rl *RateLimiter) CheckCost(ip, token string, cost int) ratelimit.Decision {
+	return rl.Evaluate(ratelimit.Request{Key: ip, Token: token, Cost: cost})
+}
+
+// checkDefault charges cost units of the key's default budget. A request
+// costing more than what is left is denied without blocking the key, since
+// cheaper requests may still fit; the key is blocked once the budget is
+// exhausted, for longer each time it is blocked again before its strikes
+// decay.
+func (rl *RateLimiter) checkDefault(ip, token string, cost int) ratelimit.Decision {
+	limit := rl.defaultLimit
+	if tokenLimit := rl.tokenLimits.LimitFor(token); tokenLimit > 0 {
+		limit = tokenLimit
+	}
+
 	req, err := rl.loadRequest(ip)
 	if err != nil {
 		log.Println("failed to load rate-limit state:", err)
-		return false
+		return rl.failureDecision(limit)
 	}
 
+	now := rl.now()
 	if rl.isBlocked(req) {
-		return false
-	}
-
-	limit := rl.defaultLimit
-	if tokenLimit := rl.tokenLimits.LimitFor(token); tokenLimit > 0 {
-		limit = tokenLimit
+		return ratelimit.Decision{Allowed: false, Limit: limit, Cost: cost, RetryAfter: req.ReleaseAt(rl.blockFor(req.Strikes)).Sub(now)}
 	}
 
 	if req.Count >= limit {
-		if err := rl.saveRequest(ratelimit.State{Key: ip, Count: 0, BlockedAt: rl.now().Unix()}); err != nil {
+		strikes := rl.strikes(req, now) + 1
+		if err := rl.saveRequest(ratelimit.State{Key: ip, Count: 0, BlockedAt: now.Unix(), Strikes: strikes}); err != nil {
 			log.Println("failed to persist blocked state:", err)
 		}
-		return false
+		return ratelimit.Decision{Allowed: false, Limit: limit, Cost: cost, RetryAfter: rl.blockFor(strikes)}
 	}
 
-	if err := rl.saveRequest(ratelimit.State{Key: ip, Count: req.Count + 1, BlockedAt: 0}); err != nil {
+	// Compared without adding, so an oversized cost cannot overflow the count.
+	if cost > limit-req.Count {
+		return ratelimit.Decision{Allowed: false, Limit: limit, Remaining: limit - req.Count, Cost: cost}
+	}
+
+	// Quotas are charged before the rate counter so a request rejected for
+	// quota does not eat into the short-term budget.
+	var quota *ratelimit.QuotaStatus
+	if rl.quota != nil {
+		status, exceeded, err := rl.consumeQuota(ip, token, cost, now)
+		if err != nil {
+			log.Println("failed to consume quota:", err)
+			return rl.failureDecision(limit)
+		}
+		if exceeded {
+			return ratelimit.Decision{Allowed: false, Limit: limit, Remaining: limit - req.Count, Cost: cost, RetryAfter: status.ResetAt.Sub(now), Quota: status, QuotaExceeded: true}
+		}
+		quota = status
+	}
+
+	if err := rl.saveRequest(ratelimit.State{Key: ip, Count: req.Count + cost, BlockedAt: req.BlockedAt, Strikes: req.Strikes}); err != nil {
 		log.Println("failed to persist request state:", err)
-		return false
+		return rl.failureDecision(limit)
 	}
 
-	return true
+	return ratelimit.Decision{Allowed: true, Limit: limit, Remaining: limit - req.Count - cost, Cost: cost, Quota: quota}
+}
+
+func (rl *RateLimiter) failureDecision(limit int) ratelimit.Decision {
+	return ratelimit.Decision{Allowed: rl.failOpen, Limit: limit}
 }
 
 func (rl *RateLimiter) loadRequest(ip string) (ratelimit.State, error) {
@@ -87,10 +153,21 @@ func (rl *RateLimiter) saveRequest(state ratelimit.State) error {
 }
 
 func (rl *RateLimiter) isBlocked(state ratelimit.State) bool {
-	return state.IsBlocked(rl.now(), rl.blockDuration)
+	return state.IsBlocked(rl.now(), rl.blockFor(state.Strikes))
+}
+
+// reset starts a new window for key. A block, and the strikes behind it, is
+// kept for as long as it matters instead of being wiped with the count.
+func (rl *RateLimiter) reset(key string) error {
+	state, err := rl.store.Get(rl.ctx, key)
+	if err == nil && rl.remembers(state, rl.now()) {
+		return rl.saveRequest(ratelimit.State{Key: key, Count: 0, BlockedAt: state.BlockedAt, Strikes: state.Strikes})
+	}
+	return rl.store.Delete(rl.ctx, key)
 }
 
 func (rl *RateLimiter) cleanupLoop() {
+	defer rl.wg.Done()
 	ticker := time.NewTicker(rl.cleanupInterval)
 	defer ticker.Stop()
 
@@ -105,8 +182,8 @@ func (rl *RateLimiter) cleanupLoop() {
 				continue
 			}
 			for _, key := range keys {
-				if err := rl.store.Delete(rl.ctx, key); err != nil {
-					log.Println("cleanup failed to delete key:", err)
+				if err := rl.reset(key); err != nil {
+					log.Println("cleanup failed to reset key:", err)
 				}
 			}
 		}
@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"errors"
+	"math"
 	"sync"
 	"testing"
 	"time"
@@ -17,13 +18,18 @@ type fakeRepository struct {
 }
 
 type fakeTokenLimits struct {
-	limits map[string]int
+	limits  map[string]int
+	tenants map[string]string
 }
 
 func (f fakeTokenLimits) LimitFor(token string) int {
 	return f.limits[token]
 }
 
+func (f fakeTokenLimits) TenantFor(token string) string {
+	return f.tenants[token]
+}
+
 func newFakeRepository() *fakeRepository {
 	return &fakeRepository{data: make(map[string]ratelimit.State)}
 }
@@ -177,3 +183,519 @@ func (f *failingRepository) ListKeys(ctx context.Context) ([]string, error) {
 func (f *failingRepository) Delete(ctx context.Context, key string) error {
 	return errors.New("repository error")
 }
+
+func TestAllow_FailOpenAllowsOnRepositoryFailure(t *testing.T) {
+	repository := &failingRepository{}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 1, 0, time.Second, tokens, repository, WithFailOpen(true))
+
+	if !ratelimiter.Allow("127.0.0.1", "") {
+		t.Fatal("expected request to be allowed when failing open")
+	}
+}
+
+func TestClose_StopsCleanupLoop(t *testing.T) {
+	repository := newFakeRepository()
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 1, time.Millisecond, time.Second, tokens, repository)
+
+	ratelimiter.Close()
+
+	if !ratelimiter.Allow("127.0.0.1", "") {
+		t.Fatal("expected first request to be allowed")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := repository.Get(context.Background(), "127.0.0.1"); err != nil {
+		t.Fatalf("expected state to survive after cleanup loop stopped, got %v", err)
+	}
+}
+
+func TestCheck_ReportsRemainingAndRetryAfter(t *testing.T) {
+	repository := newFakeRepository()
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 2, 0, 10*time.Second, tokens, repository)
+
+	now := time.Unix(1700000000, 0)
+	ratelimiter.now = func() time.Time { return now }
+
+	decision := ratelimiter.Check("127.0.0.1", "")
+	if !decision.Allowed || decision.Limit != 2 || decision.Remaining != 1 {
+		t.Fatalf("unexpected first decision: %#v", decision)
+	}
+
+	decision = ratelimiter.Check("127.0.0.1", "")
+	if !decision.Allowed || decision.Remaining != 0 {
+		t.Fatalf("unexpected second decision: %#v", decision)
+	}
+
+	decision = ratelimiter.Check("127.0.0.1", "")
+	if decision.Allowed || decision.RetryAfter != 10*time.Second {
+		t.Fatalf("expected block with 10s retry, got %#v", decision)
+	}
+
+	now = now.Add(4 * time.Second)
+	decision = ratelimiter.Check("127.0.0.1", "")
+	if decision.Allowed || decision.RetryAfter != 6*time.Second {
+		t.Fatalf("expected remaining block of 6s, got %#v", decision)
+	}
+}
+
+type fakeConcurrencyRepository struct {
+	leases map[string]bool
+}
+
+func (f *fakeConcurrencyRepository) Acquire(ctx context.Context, key, id string, limit int, lease time.Duration) (int, bool, error) {
+	if len(f.leases) >= limit {
+		return len(f.leases), false, nil
+	}
+	f.leases[id] = true
+	return len(f.leases), true, nil
+}
+
+func (f *fakeConcurrencyRepository) Release(ctx context.Context, key, id string) error {
+	delete(f.leases, id)
+	return nil
+}
+
+func TestAcquire_LimitsInFlightRequests(t *testing.T) {
+	store := &fakeConcurrencyRepository{leases: map[string]bool{}}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 10, 0, time.Second, tokens, newFakeRepository(), WithConcurrencyLimit(1, time.Minute, store))
+
+	release, decision := ratelimiter.Acquire("127.0.0.1", "")
+	if !decision.Allowed || decision.Limit != 1 || decision.Remaining != 0 {
+		t.Fatalf("unexpected first decision: %#v", decision)
+	}
+
+	if _, decision := ratelimiter.Acquire("127.0.0.1", ""); decision.Allowed {
+		t.Fatal("expected second in-flight request to be denied")
+	}
+
+	release()
+	if _, decision := ratelimiter.Acquire("127.0.0.1", ""); !decision.Allowed {
+		t.Fatal("expected slot to be available after release")
+	}
+}
+
+func TestAcquire_WithoutConcurrencyLimitAlwaysAllows(t *testing.T) {
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 10, 0, time.Second, tokens, newFakeRepository())
+
+	release, decision := ratelimiter.Acquire("127.0.0.1", "")
+	defer release()
+	if !decision.Allowed || decision.Limit != 0 {
+		t.Fatalf("unexpected decision: %#v", decision)
+	}
+}
+
+func TestCheckCost_DeductsWeightedCost(t *testing.T) {
+	repository := newFakeRepository()
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 100, 0, 10*time.Second, tokens, repository)
+
+	decision := ratelimiter.CheckCost("127.0.0.1", "", 60)
+	if !decision.Allowed || decision.Remaining != 40 || decision.Cost != 60 {
+		t.Fatalf("unexpected first decision: %#v", decision)
+	}
+
+	decision = ratelimiter.CheckCost("127.0.0.1", "", 60)
+	if decision.Allowed || decision.Remaining != 40 || decision.RetryAfter != 0 {
+		t.Fatalf("expected denial without block when cost exceeds the remaining budget, got %#v", decision)
+	}
+
+	decision = ratelimiter.Check("127.0.0.1", "")
+	if !decision.Allowed || decision.Remaining != 39 {
+		t.Fatalf("expected cheaper request to still fit, got %#v", decision)
+	}
+
+	state, _ := repository.Get(context.Background(), "127.0.0.1")
+	if state.Count != 61 || state.BlockedAt != 0 {
+		t.Fatalf("expected 61 consumed units and no block, got %#v", state)
+	}
+
+	if decision := ratelimiter.CheckCost("127.0.0.1", "", math.MaxInt); decision.Allowed {
+		t.Fatalf("expected an oversized cost to be denied, got %#v", decision)
+	}
+	if state, _ := repository.Get(context.Background(), "127.0.0.1"); state.Count != 61 {
+		t.Fatalf("expected the count to be left untouched, got %#v", state)
+	}
+}
+
+type fakeQuotaRepository struct {
+	used map[string]int
+}
+
+func (f *fakeQuotaRepository) Consume(ctx context.Context, key string, cost int, buckets []ports.QuotaBucket) ([]int, int, error) {
+	used := make([]int, len(buckets))
+	for i, bucket := range buckets {
+		used[i] = f.used[key+bucket.Name]
+		if used[i]+cost > bucket.Limit {
+			return used, i, nil
+		}
+	}
+	for i, bucket := range buckets {
+		used[i] += cost
+		f.used[key+bucket.Name] = used[i]
+	}
+	return used, -1, nil
+}
+
+func TestCheck_QuotaExceededIsReportedApartFromRateLimit(t *testing.T) {
+	repository := newFakeRepository()
+	quotas := &fakeQuotaRepository{used: map[string]int{}}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 10, 0, time.Second, tokens, repository, WithQuotas([]ratelimit.Quota{
+		{Period: ratelimit.PeriodDay, Limit: 5},
+		{Period: ratelimit.PeriodMonth, Limit: 2},
+	}, time.UTC, quotas))
+
+	now := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	ratelimiter.now = func() time.Time { return now }
+
+	decision := ratelimiter.Check("127.0.0.1", "")
+	if !decision.Allowed || decision.Quota == nil || decision.Quota.Period != ratelimit.PeriodMonth || decision.Quota.Remaining != 1 {
+		t.Fatalf("expected monthly quota to be the most restrictive, got %#v", decision)
+	}
+
+	ratelimiter.Check("127.0.0.1", "")
+	decision = ratelimiter.Check("127.0.0.1", "")
+	if decision.Allowed || !decision.QuotaExceeded || decision.Quota.Period != ratelimit.PeriodMonth {
+		t.Fatalf("expected monthly quota denial, got %#v", decision)
+	}
+	if want := time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC).Sub(now); decision.RetryAfter != want {
+		t.Fatalf("expected retry at the end of the month (%s), got %s", want, decision.RetryAfter)
+	}
+
+	state, _ := repository.Get(context.Background(), "127.0.0.1")
+	if state.Count != 2 {
+		t.Fatalf("expected quota denial not to consume the rate budget, got count %d", state.Count)
+	}
+}
+
+func TestEvaluate_MultiWindowRule(t *testing.T) {
+	buckets := &fakeQuotaRepository{used: map[string]int{}}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 1, 0, time.Second, tokens, newFakeRepository(), WithBucketStore(buckets))
+
+	now := time.Unix(1700000040, 0)
+	ratelimiter.now = func() time.Time { return now }
+	req := ratelimit.Request{Key: "127.0.0.1", Cost: 1, Rule: "search", Windows: []ratelimit.Window{
+		{Limit: 2, Duration: time.Second},
+		{Limit: 3, Duration: time.Minute},
+	}}
+
+	decision := ratelimiter.Evaluate(req)
+	if !decision.Allowed || decision.Limit != 2 || decision.Remaining != 1 || decision.Window != time.Second {
+		t.Fatalf("expected the per-second window to be the most restrictive, got %#v", decision)
+	}
+
+	ratelimiter.Evaluate(req)
+	decision = ratelimiter.Evaluate(req)
+	if decision.Allowed || decision.Window != time.Second || decision.RetryAfter != time.Second {
+		t.Fatalf("expected per-second denial, got %#v", decision)
+	}
+
+	now = now.Add(time.Second)
+	decision = ratelimiter.Evaluate(req)
+	if !decision.Allowed || decision.Window != time.Minute || decision.Remaining != 0 {
+		t.Fatalf("expected the per-minute window to be reported once it is the tightest, got %#v", decision)
+	}
+
+	now = now.Add(time.Second)
+	decision = ratelimiter.Evaluate(req)
+	if decision.Allowed || decision.Window != time.Minute || decision.RetryAfter != 58*time.Second {
+		t.Fatalf("expected per-minute denial, got %#v", decision)
+	}
+	if buckets.used["127.0.0.1window:search:1s:1700000042"] != 0 {
+		t.Fatal("expected a denied request not to be charged to any window")
+	}
+}
+
+func TestEvaluate_WithoutWindowsUsesDefaultLimit(t *testing.T) {
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 1, 0, time.Second, tokens, newFakeRepository())
+
+	if decision := ratelimiter.Evaluate(ratelimit.Request{Key: "127.0.0.1", Cost: 1}); !decision.Allowed || decision.Limit != 1 {
+		t.Fatalf("unexpected decision: %#v", decision)
+	}
+	if decision := ratelimiter.Evaluate(ratelimit.Request{Key: "127.0.0.1", Cost: 1}); decision.Allowed {
+		t.Fatal("expected default limit to apply")
+	}
+}
+
+func TestEvaluate_HierarchicalScopes(t *testing.T) {
+	buckets := &fakeQuotaRepository{used: map[string]int{}}
+	tokens := fakeTokenLimits{tenants: map[string]string{"key-a": "acme", "key-b": "acme", "key-c": "globex"}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 10, 0, time.Second, tokens, newFakeRepository(),
+		WithBucketStore(buckets),
+		WithScopes([]ratelimit.Scope{
+			{Level: ratelimit.ScopeGlobal, Limit: 100, Duration: time.Minute},
+			{Level: ratelimit.ScopeTenant, Limit: 3, Duration: time.Minute},
+			{Level: ratelimit.ScopeKey, Limit: 2, Duration: time.Minute},
+		}),
+	)
+	ratelimiter.now = func() time.Time { return time.Unix(1700000040, 0) }
+
+	request := func(ip, subject string) ratelimit.Request {
+		return ratelimit.Request{Key: ip, Token: subject, Cost: 1, Identity: ratelimit.Identity{Subject: subject}}
+	}
+
+	decision := ratelimiter.Evaluate(request("10.0.0.1", "key-a"))
+	if !decision.Allowed || decision.Scope != ratelimit.ScopeKey || decision.Remaining != 1 {
+		t.Fatalf("expected key scope to be the tightest, got %#v", decision)
+	}
+	ratelimiter.Evaluate(request("10.0.0.2", "key-a"))
+	if decision := ratelimiter.Evaluate(request("10.0.0.3", "key-a")); decision.Allowed || decision.Scope != ratelimit.ScopeKey {
+		t.Fatalf("expected key budget to be shared across IPs, got %#v", decision)
+	}
+
+	if decision := ratelimiter.Evaluate(request("10.0.0.4", "key-b")); !decision.Allowed || decision.Scope != ratelimit.ScopeTenant || decision.Remaining != 0 {
+		t.Fatalf("expected tenant scope to be the tightest, got %#v", decision)
+	}
+	if decision := ratelimiter.Evaluate(request("10.0.0.5", "key-b")); decision.Allowed || decision.Scope != ratelimit.ScopeTenant || decision.RetryAfter != time.Minute {
+		t.Fatalf("expected tenant budget to be exhausted, got %#v", decision)
+	}
+
+	if decision := ratelimiter.Evaluate(request("10.0.0.6", "key-c")); !decision.Allowed {
+		t.Fatalf("expected another tenant to keep its own budget, got %#v", decision)
+	}
+	if decision := ratelimiter.Check("10.0.0.7", "key-b"); decision.Allowed || decision.Scope != ratelimit.ScopeTenant {
+		t.Fatalf("expected an API key alone to be charged to its tenant, got %#v", decision)
+	}
+
+	global := buckets.used["global:*window:scope:1m0s:1700000040"]
+	if global != 4 {
+		t.Fatalf("expected denied requests to be refunded from the global scope, got %d", global)
+	}
+}
+
+func TestEvaluate_ScopesByIdentity(t *testing.T) {
+	buckets := &fakeQuotaRepository{used: map[string]int{}}
+	tokens := fakeTokenLimits{limits: map[string]int{"pro": 10}, tenants: map[string]string{"pro": "shared"}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 10, 0, time.Second, tokens, newFakeRepository(),
+		WithBucketStore(buckets),
+		WithScopes([]ratelimit.Scope{
+			{Level: ratelimit.ScopeTenant, Limit: 100, Duration: time.Minute},
+			{Level: ratelimit.ScopeKey, Limit: 1, Duration: time.Minute},
+		}),
+	)
+	ratelimiter.now = func() time.Time { return time.Unix(1700000040, 0) }
+
+	alice := ratelimit.Identity{Subject: "alice", Tenant: "acme"}
+	if decision := ratelimiter.Evaluate(ratelimit.Request{Key: "jwt:sub=alice", Token: "pro", Cost: 1, Identity: alice}); !decision.Allowed {
+		t.Fatalf("expected first request to be allowed, got %#v", decision)
+	}
+	bob := ratelimit.Identity{Subject: "bob", Tenant: "acme"}
+	if decision := ratelimiter.Evaluate(ratelimit.Request{Key: "jwt:sub=bob", Token: "pro", Cost: 1, Identity: bob}); !decision.Allowed {
+		t.Fatalf("expected subjects on the same tier to have their own key budget, got %#v", decision)
+	}
+	if decision := ratelimiter.Evaluate(ratelimit.Request{Key: "jwt:sub=alice", Token: "pro", Cost: 1, Identity: alice}); decision.Allowed || decision.Scope != ratelimit.ScopeKey {
+		t.Fatalf("expected subject budget to be exhausted, got %#v", decision)
+	}
+
+	if buckets.used["tenant:acmewindow:scope:1m0s:1700000040"] != 2 || buckets.used["tenant:sharedwindow:scope:1m0s:1700000040"] != 0 {
+		t.Fatalf("expected the identity tenant to be charged, got %v", buckets.used)
+	}
+}
+
+func TestCheck_EscalatesBlockForRepeatOffenders(t *testing.T) {
+	repository := newFakeRepository()
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	escalation := ratelimit.Escalation{Multiplier: 2, Max: 3 * time.Minute, Decay: time.Hour}
+	ratelimiter := NewIpRateLimiter(context.Background(), 1, 0, time.Minute, tokens, repository, WithEscalation(escalation))
+
+	now := time.Unix(1700000000, 0)
+	ratelimiter.now = func() time.Time { return now }
+
+	for _, expected := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		if !ratelimiter.Check("127.0.0.1", "").Allowed {
+			t.Fatal("expected request to be allowed")
+		}
+		decision := ratelimiter.Check("127.0.0.1", "")
+		if decision.Allowed || decision.RetryAfter != expected {
+			t.Fatalf("expected block of %s, got %#v", expected, decision)
+		}
+
+		now = now.Add(expected - time.Second)
+		if ratelimiter.Check("127.0.0.1", "").Allowed {
+			t.Fatalf("expected key to stay blocked for %s", expected)
+		}
+		now = now.Add(time.Second)
+	}
+
+	now = now.Add(time.Hour)
+	ratelimiter.Check("127.0.0.1", "")
+	decision := ratelimiter.Check("127.0.0.1", "")
+	if decision.RetryAfter != time.Minute {
+		t.Fatalf("expected strikes to decay back to the base block, got %#v", decision)
+	}
+	if state := repository.stateByKey(t, "127.0.0.1"); state.Strikes != 1 {
+		t.Fatalf("expected strike count to restart at 1, got %d", state.Strikes)
+	}
+}
+
+func TestReset_KeepsBlockAndStrikes(t *testing.T) {
+	repository := newFakeRepository()
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	escalation := ratelimit.Escalation{Multiplier: 2, Decay: time.Hour}
+	ratelimiter := NewIpRateLimiter(context.Background(), 1, 0, time.Minute, tokens, repository, WithEscalation(escalation))
+
+	now := time.Unix(1700000000, 0)
+	ratelimiter.now = func() time.Time { return now }
+	_ = repository.Save(context.Background(), ratelimit.State{Key: "blocked", BlockedAt: now.Unix(), Strikes: 2})
+	_ = repository.Save(context.Background(), ratelimit.State{Key: "idle", Count: 1})
+
+	for _, key := range []string{"blocked", "idle"} {
+		if err := ratelimiter.reset(key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if state := repository.stateByKey(t, "blocked"); state.BlockedAt != now.Unix() || state.Strikes != 2 {
+		t.Fatalf("expected block to survive the reset, got %#v", state)
+	}
+	if _, ok := repository.data["idle"]; ok {
+		t.Fatal("expected idle key to be deleted")
+	}
+
+	now = now.Add(2*time.Minute + time.Hour)
+	if err := ratelimiter.reset("blocked"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := repository.data["blocked"]; ok {
+		t.Fatal("expected key to be deleted once its strikes decayed")
+	}
+}
+
+type fakePenaltyRepository struct {
+	counts map[string]int
+	boxes  map[string]time.Time
+	now    func() time.Time
+}
+
+func (f *fakePenaltyRepository) Penalize(ctx context.Context, key string, threshold int, window, block time.Duration) (time.Time, error) {
+	f.counts[key]++
+	if f.counts[key] < threshold {
+		return time.Time{}, nil
+	}
+	f.counts[key] = 0
+	f.boxes[key] = f.now().Add(block)
+	return f.boxes[key], nil
+}
+
+func (f *fakePenaltyRepository) ReleaseAt(ctx context.Context, key string) (time.Time, error) {
+	return f.boxes[key], nil
+}
+
+func (f *fakePenaltyRepository) Clear(ctx context.Context, key string) error {
+	delete(f.counts, key)
+	delete(f.boxes, key)
+	return nil
+}
+
+func TestEvaluate_PenaltyBoxBlocksBadResponses(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	penalties := &fakePenaltyRepository{counts: map[string]int{}, boxes: map[string]time.Time{}, now: clock}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 100, 0, time.Second, tokens, newFakeRepository(),
+		WithPenaltyBox([]int{401, 404}, 2, time.Minute, 10*time.Minute, penalties))
+	ratelimiter.now = clock
+
+	ratelimiter.Report("10.0.0.1", 404)
+	ratelimiter.Report("10.0.0.1", 200)
+	ratelimiter.Report("10.0.0.1", 500)
+	if decision := ratelimiter.Check("10.0.0.1", ""); !decision.Allowed {
+		t.Fatalf("expected key below the threshold to be allowed, got %#v", decision)
+	}
+
+	ratelimiter.Report("10.0.0.1", 401)
+	decision := ratelimiter.Check("10.0.0.1", "")
+	if decision.Allowed || !decision.Penalized || decision.RetryAfter != 10*time.Minute {
+		t.Fatalf("expected key to be boxed for 10m, got %#v", decision)
+	}
+	if !ratelimiter.Check("10.0.0.2", "").Allowed {
+		t.Fatal("expected other keys to be unaffected")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if !ratelimiter.Check("10.0.0.1", "").Allowed {
+		t.Fatal("expected key to be released after the penalty")
+	}
+}
+
+func TestEvaluate_LocksAccountAfterFailedLogins(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	lockouts := &fakePenaltyRepository{counts: map[string]int{}, boxes: map[string]time.Time{}, now: clock}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 100, 0, time.Second, tokens, newFakeRepository(), WithLockoutStore(lockouts))
+	ratelimiter.now = clock
+
+	lockout := &ratelimit.Lockout{MaxFailures: 3, Window: time.Minute, Duration: 30 * time.Minute, FailureStatuses: []int{401}}
+	attempt := func(ip, account string) ratelimit.Request {
+		return ratelimit.Request{Key: ip, Cost: 1, Rule: "login", Account: account, Lockout: lockout}
+	}
+
+	ratelimiter.RecordLogin(attempt("10.0.0.1", "alice"), 401)
+	ratelimiter.RecordLogin(attempt("10.0.0.2", "Alice"), 401)
+	ratelimiter.RecordLogin(attempt("10.0.0.3", "alice"), 200)
+	if lockouts.counts["account:alice"] != 0 {
+		t.Fatalf("expected a successful login to forget failures, got %d", lockouts.counts["account:alice"])
+	}
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		ratelimiter.RecordLogin(attempt(ip, "alice"), 401)
+	}
+	decision := ratelimiter.Evaluate(attempt("10.0.0.4", "ALICE"))
+	if decision.Allowed || !decision.Locked || decision.RetryAfter != 30*time.Minute {
+		t.Fatalf("expected account locked from any IP for 30m, got %#v", decision)
+	}
+	if !ratelimiter.Evaluate(attempt("10.0.0.4", "bob")).Allowed {
+		t.Fatal("expected other accounts to be unaffected")
+	}
+
+	if err := ratelimiter.Unlock("alice"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !ratelimiter.Evaluate(attempt("10.0.0.4", "alice")).Allowed {
+		t.Fatal("expected unlocked account to be allowed")
+	}
+}
+
+func TestEvaluate_ShadowRuleNeverDenies(t *testing.T) {
+	repository := newFakeRepository()
+	buckets := &fakeQuotaRepository{used: map[string]int{}}
+	tokens := fakeTokenLimits{limits: map[string]int{}}
+	ratelimiter := NewIpRateLimiter(context.Background(), 2, 0, time.Minute, tokens, repository,
+		WithBucketStore(buckets),
+		WithScopes([]ratelimit.Scope{{Level: ratelimit.ScopeGlobal, Limit: 100, Duration: time.Minute}}),
+	)
+	ratelimiter.now = func() time.Time { return time.Unix(1700000040, 0) }
+
+	shadow := ratelimit.Request{Key: "10.0.0.1", Cost: 1, Rule: "strict", Windows: []ratelimit.Window{{Limit: 1, Duration: time.Minute}}}
+	req := ratelimit.Request{Key: "10.0.0.1", Cost: 1, Shadow: &shadow}
+	if decision := ratelimiter.Evaluate(req); !decision.Allowed || decision.ShadowDenied || decision.Limit != 2 {
+		t.Fatalf("expected first request to fit both limits, got %#v", decision)
+	}
+
+	before := shadowDenials.Get("strict")
+	decision := ratelimiter.Evaluate(req)
+	if !decision.Allowed || !decision.ShadowDenied {
+		t.Fatalf("expected would-be denial to be let through, got %#v", decision)
+	}
+	if after := shadowDenials.Get("strict"); after == nil || before != nil && after.String() == before.String() {
+		t.Fatalf("expected shadow denial to be counted, got %v", after)
+	}
+
+	if decision := ratelimiter.Evaluate(req); decision.Allowed {
+		t.Fatal("expected the enforced default limit to keep applying next to the shadow rule")
+	}
+	if _, ok := buckets.used["shadow:strict:10.0.0.1window:strict:1m0s:1700000040"]; !ok {
+		t.Fatalf("expected shadow counters to be kept apart, got %v", buckets.used)
+	}
+	if global := buckets.used["global:*window:scope:1m0s:1700000040"]; global != 2 {
+		t.Fatalf("expected only enforced requests to charge the scopes, got %d", global)
+	}
+}
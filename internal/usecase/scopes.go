@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"log"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+type scopeCharge struct {
+	key    string
+	level  ratelimit.ScopeLevel
+	window time.Duration
+	bucket ports.QuotaBucket
+	used   int
+}
+
+// WithScopes adds budgets shared above the client IP: global, per tenant and
+// per API key. Every request consumes from each level that applies to it.
+// The counters live in the bucket store.
+func WithScopes(scopes []ratelimit.Scope) Option {
+	return func(rl *RateLimiter) {
+		rl.scopes = scopes
+	}
+}
+
+// consumeScopes charges the request to every scope from the broadest down.
+// Each scope id is its own key, so that in Redis Cluster the counters spread
+// over the slots; the levels are therefore charged one by one and refunded
+// when a later level denies.
+func (rl *RateLimiter) consumeScopes(req ratelimit.Request) ([]scopeCharge, *ratelimit.Decision) {
+	if len(rl.scopes) == 0 || rl.buckets == nil {
+		return nil, nil
+	}
+
+	now := rl.now()
+	charged := make([]scopeCharge, 0, len(rl.scopes))
+	for _, scope := range rl.scopes {
+		id := rl.scopeID(scope.Level, req)
+		if id == "" {
+			continue
+		}
+
+		name, resetAt := ratelimit.Window{Duration: scope.Duration}.Bucket("scope", now)
+		charge := scopeCharge{
+			key:    string(scope.Level) + ":" + id,
+			level:  scope.Level,
+			window: scope.Duration,
+			bucket: ports.QuotaBucket{Name: name, Limit: scope.LimitFor(id), ExpireAt: resetAt},
+		}
+		used, exceeded, err := rl.buckets.Consume(rl.ctx, charge.key, req.Cost, []ports.QuotaBucket{charge.bucket})
+		if err != nil {
+			log.Println("failed to consume scope budget:", err)
+			if rl.failOpen {
+				continue
+			}
+			rl.refundScopes(charged, req.Cost)
+			decision := rl.failureDecision(charge.bucket.Limit)
+			return nil, &decision
+		}
+		if exceeded >= 0 {
+			rl.refundScopes(charged, req.Cost)
+			log.Printf("%s scope %q: limit of %d per %s exceeded by %s", scope.Level, id, charge.bucket.Limit, scope.Duration, req.Key)
+			return nil, &ratelimit.Decision{
+				Allowed:    false,
+				Limit:      charge.bucket.Limit,
+				Remaining:  max(charge.bucket.Limit-used[0], 0),
+				Cost:       req.Cost,
+				Window:     scope.Duration,
+				Scope:      scope.Level,
+				RetryAfter: resetAt.Sub(now),
+			}
+		}
+		charge.used = used[0]
+		charged = append(charged, charge)
+	}
+	return charged, nil
+}
+
+// refundScopes gives the cost back to every charged scope once the request
+// is denied by a later level or by its own limit.
+func (rl *RateLimiter) refundScopes(charged []scopeCharge, cost int) {
+	for _, charge := range charged {
+		if _, _, err := rl.buckets.Consume(rl.ctx, charge.key, -cost, []ports.QuotaBucket{charge.bucket}); err != nil {
+			log.Println("failed to refund scope budget:", err)
+		}
+	}
+}
+
+// scopeID prefers the identity the client authenticated as over the key
+// derived from its token. The tenant named by the identity wins over the one
+// the token registry assigns to the key.
+func (rl *RateLimiter) scopeID(level ratelimit.ScopeLevel, req ratelimit.Request) string {
+	switch level {
+	case ratelimit.ScopeGlobal:
+		return "*"
+	case ratelimit.ScopeTenant:
+		if req.Identity.Tenant != "" {
+			return req.Identity.Tenant
+		}
+		tenants, ok := rl.tokenLimits.(ports.TenantProvider)
+		key := rl.scopeID(ratelimit.ScopeKey, req)
+		if !ok || key == "" {
+			return ""
+		}
+		return tenants.TenantFor(key)
+	case ratelimit.ScopeKey:
+		if req.Identity.Subject != "" {
+			return req.Identity.Subject
+		}
+		return req.Token
+	default:
+		return ""
+	}
+}
+
+// tighterScope reports a shared scope instead of the key's own limit when the
+// scope has less budget left.
+func tighterScope(decision ratelimit.Decision, charged []scopeCharge) ratelimit.Decision {
+	for _, charge := range charged {
+		remaining := max(charge.bucket.Limit-charge.used, 0)
+		if decision.Limit > 0 && remaining >= decision.Remaining {
+			continue
+		}
+		decision.Limit = charge.bucket.Limit
+		decision.Remaining = remaining
+		decision.Window = charge.window
+		decision.Scope = charge.level
+	}
+	return decision
+}
@@ -0,0 +1,33 @@
+package usecase
+
+import (
+	"expvar"
+	"log"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+var (
+	shadowRequests = expvar.NewMap("ratelimit_shadow_requests")
+	shadowDenials  = expvar.NewMap("ratelimit_shadow_denials")
+)
+
+// shadow evaluates a rule in dry-run mode and reports whether it would have
+// denied the request; the verdict is logged and counted per rule. The shadow
+// rule only touches counters of its own: its windows and default limit are
+// kept under a "shadow:" key, so a would-be block never spills over to the
+// enforced limits, and the shared scopes are not charged at all.
+func (rl *RateLimiter) shadow(req ratelimit.Request) bool {
+	ip := req.Key
+	req.Key = "shadow:" + req.Rule + ":" + ip
+	req.Cost = max(req.Cost, 1)
+	decision := rl.checkLimits(req)
+
+	shadowRequests.Add(req.Rule, 1)
+	if decision.Allowed {
+		return false
+	}
+	shadowDenials.Add(req.Rule, 1)
+	log.Printf("shadow rule %q would deny %s (limit %d, retry after %s)", req.Rule, ip, decision.Limit, decision.RetryAfter)
+	return true
+}
@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"log"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+)
+
+// Evaluate checks a request against the penalty box, the lockout of the
+// account it logs into, the shared scopes and then its rule. Requests without
+// windows are counted against the default limit. A shadow rule is evaluated
+// on the side and never changes the verdict.
+func (rl *RateLimiter) Evaluate(req ratelimit.Request) ratelimit.Decision {
+	req.Cost = max(req.Cost, 1)
+	shadowDenied := req.Shadow != nil && rl.shadow(*req.Shadow)
+	decision := rl.enforce(req)
+	decision.ShadowDenied = shadowDenied
+	return decision
+}
+
+func (rl *RateLimiter) enforce(req ratelimit.Request) ratelimit.Decision {
+	if rl.penalty != nil {
+		if decision, final := rl.checkPenalty(req.Key); final {
+			return decision
+		}
+	}
+	if rl.lockouts != nil && req.Lockout != nil && req.Account != "" {
+		if decision, final := rl.checkLockout(req); final {
+			return decision
+		}
+	}
+	return rl.checkRule(req)
+}
+
+func (rl *RateLimiter) checkRule(req ratelimit.Request) ratelimit.Decision {
+	charged, denied := rl.consumeScopes(req)
+	if denied != nil {
+		return *denied
+	}
+
+	decision := rl.checkLimits(req)
+	if !decision.Allowed {
+		rl.refundScopes(charged, req.Cost)
+		return decision
+	}
+	return tighterScope(decision, charged)
+}
+
+// checkLimits counts the request against the windows of its rule or, without
+// them, the default limit.
+func (rl *RateLimiter) checkLimits(req ratelimit.Request) ratelimit.Decision {
+	if len(req.Windows) > 0 && rl.buckets != nil {
+		return rl.checkWindows(req)
+	}
+	return rl.checkDefault(req.Key, req.Token, req.Cost)
+}
+
+// checkWindows charges every window of the rule, and the quotas, in a single
+// store call: either all of them accept the cost or none is charged. The
+// decision describes the window that denied the request or, when allowed,
+// the one closest to exhaustion.
+func (rl *RateLimiter) checkWindows(req ratelimit.Request) ratelimit.Decision {
+	cost := req.Cost
+	now := rl.now()
+
+	windows := len(req.Windows)
+	buckets := make([]ports.QuotaBucket, 0, windows)
+	for _, window := range req.Windows {
+		name, resetAt := window.Bucket(req.Rule, now)
+		buckets = append(buckets, ports.QuotaBucket{Name: name, Limit: window.LimitFor(req.Token), ExpireAt: resetAt})
+	}
+	var quotas []ratelimit.QuotaStatus
+	if rl.quota != nil {
+		quotaBuckets, statuses := rl.quotaBuckets(req.Token, now)
+		buckets = append(buckets, quotaBuckets...)
+		quotas = statuses
+	}
+
+	used, exceeded, err := rl.buckets.Consume(rl.ctx, req.Key, cost, buckets)
+	if err != nil {
+		log.Println("failed to consume rule windows:", err)
+		return rl.failureDecision(buckets[0].Limit)
+	}
+
+	tightest := exceeded
+	if exceeded < 0 || exceeded >= windows {
+		tightest = 0
+		for i := 1; i < windows; i++ {
+			if buckets[i].Limit-used[i] < buckets[tightest].Limit-used[tightest] {
+				tightest = i
+			}
+		}
+	}
+
+	decision := ratelimit.Decision{
+		Allowed:   exceeded < 0,
+		Limit:     buckets[tightest].Limit,
+		Remaining: max(buckets[tightest].Limit-used[tightest], 0),
+		Cost:      cost,
+		Window:    req.Windows[tightest].Duration,
+	}
+	if quotas != nil {
+		quotaExceeded := -1
+		if exceeded >= windows {
+			quotaExceeded = exceeded - windows
+		}
+		decision.Quota = tightestQuota(quotas, used[windows:], quotaExceeded)
+	}
+
+	switch {
+	case exceeded >= windows:
+		decision.QuotaExceeded = true
+		decision.RetryAfter = decision.Quota.ResetAt.Sub(now)
+		log.Printf("rule %q: %s quota of %d exhausted for %s", req.Rule, decision.Quota.Period, decision.Quota.Limit, req.Key)
+	case exceeded >= 0:
+		decision.RetryAfter = buckets[tightest].ExpireAt.Sub(now)
+		log.Printf("rule %q: limit of %d per %s exceeded for %s", req.Rule, decision.Limit, decision.Window, req.Key)
+	}
+	return decision
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Unlocker lifts the lockout of an account.
+type Unlocker interface {
+	Unlock(account string) error
+}
+
+// UnlockHandler serves DELETE /admin/lockouts/{account}. Callers must send
+// token as a bearer token.
+func UnlockHandler(unlocker Unlocker, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		account := r.PathValue("account")
+		if err := unlocker.Unlock(account); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "unlocked", "account": account})
+	}
+}
+
+func authorized(r *http.Request, token string) bool {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeUnlocker struct {
+	unlocked []string
+}
+
+func (f *fakeUnlocker) Unlock(account string) error {
+	f.unlocked = append(f.unlocked, account)
+	return nil
+}
+
+func TestUnlockHandler(t *testing.T) {
+	unlocker := &fakeUnlocker{}
+	mux := http.NewServeMux()
+	mux.Handle("DELETE /admin/lockouts/{account}", UnlockHandler(unlocker, "secret"))
+
+	cases := []struct {
+		authorization string
+		status        int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/lockouts/alice", nil)
+		req.Header.Set("Authorization", tc.authorization)
+		rec := httptest.NewRecorder()
+
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Fatalf("expected status %d for %q, got %d", tc.status, tc.authorization, rec.Code)
+		}
+	}
+
+	if len(unlocker.unlocked) != 1 || unlocker.unlocked[0] != "alice" {
+		t.Fatalf("expected only the authorized call to unlock alice, got %v", unlocker.unlocked)
+	}
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func ReadinessHandler(checks ...HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		defer cancel()
+
+		resp := readinessResponse{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+		status := http.StatusOK
+		for _, check := range checks {
+			if err := check.Check(ctx); err != nil {
+				resp.Checks[check.Name] = checkResult{Status: "fail", Error: err.Error()}
+				resp.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[check.Name] = checkResult{Status: "ok"}
+		}
+
+		writeJSON(w, status, resp)
+	}
+}
+
+func CircuitBreakerHealthHandler(state func() string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := state()
+		status := http.StatusOK
+		if current == "open" {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, status, map[string]string{"circuit_breaker": current})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp any) {
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(jsonResp)
+}
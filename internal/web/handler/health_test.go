@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCircuitBreakerHealthHandler(t *testing.T) {
+	cases := []struct {
+		state  string
+		status int
+	}{
+		{state: "closed", status: http.StatusOK},
+		{state: "half-open", status: http.StatusOK},
+		{state: "open", status: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/health/circuit-breaker", nil)
+		rec := httptest.NewRecorder()
+
+		CircuitBreakerHealthHandler(func() string { return tc.state })(rec, req)
+
+		if rec.Code != tc.status {
+			t.Fatalf("expected status %d for state %s, got %d", tc.status, tc.state, rec.Code)
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+
+		if body["circuit_breaker"] != tc.state {
+			t.Fatalf("expected circuit_breaker %q, got %q", tc.state, body["circuit_breaker"])
+		}
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	rec := httptest.NewRecorder()
+
+	LivenessHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("expected content-type application/json, got %s", contentType)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	healthy := HealthCheck{Name: "redis", Check: func(ctx context.Context) error { return nil }}
+	failing := HealthCheck{Name: "circuit_breaker", Check: func(ctx context.Context) error { return errors.New("circuit breaker is open") }}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+	ReadinessHandler(healthy)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	ReadinessHandler(healthy, failing)(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rec.Code)
+	}
+
+	var body readinessResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if body.Status != "unavailable" {
+		t.Fatalf("expected status unavailable, got %q", body.Status)
+	}
+
+	if body.Checks["redis"].Status != "ok" {
+		t.Fatalf("expected redis check ok, got %#v", body.Checks["redis"])
+	}
+
+	if body.Checks["circuit_breaker"].Error != "circuit breaker is open" {
+		t.Fatalf("expected circuit breaker failure detail, got %#v", body.Checks["circuit_breaker"])
+	}
+}
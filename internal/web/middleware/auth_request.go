@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+// AuthRequestHandler answers NGINX auth_request sub-requests and Envoy HTTP
+// ext_authz checks: 200 lets the original request through, 429 rejects it.
+// NGINX only understands 401 and 403 as denials, so the rejection status can
+// be overridden with ?deny_status=403. The client address is taken from the
+// headers set by the proxy only when the request comes from one of the
+// proxies trusted with WithTrustedProxies; otherwise it is the peer address.
+func AuthRequestHandler(limiter Limiter, opts ...Option) http.Handler {
+	o := newOptions(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := forwardedClientIP(r, o.trustedProxies)
+		if ip == "" {
+			http.Error(w, "missing client address", http.StatusBadRequest)
+			return
+		}
+
+		denyStatus := http.StatusTooManyRequests
+		if raw := r.URL.Query().Get("deny_status"); raw != "" {
+			status, err := strconv.Atoi(raw)
+			if err != nil || status < 400 || status > 599 {
+				http.Error(w, "invalid deny_status", http.StatusBadRequest)
+				return
+			}
+			denyStatus = status
+		}
+
+		token := ratelimit.ClientToken(r.Header.Get("API_KEY"))
+		if decision := evaluate(w, limiter, ratelimit.Request{Key: ip, Token: token, Cost: 1}); !decision.Allowed {
+			writeDenial(w, r, nil, decision, denyStatus, denialMessage(decision))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// forwardedClientIP ignores the forwarding headers unless the peer is a
+// trusted proxy, so clients cannot spend or block the budget of another
+// address. X-Forwarded-For is read from the right, skipping the trusted hops;
+// X-Real-IP is never read, since proxies pass a client-supplied one through.
+// Values that are not IP addresses are ignored.
+func forwardedClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip, ok := parseIP(hops[i])
+			if !ok {
+				break
+			}
+			if i == 0 || !isTrusted(ip, trusted) {
+				return ip
+			}
+		}
+	}
+	if ip, ok := parseIP(r.Header.Get("X-Envoy-External-Address")); ok {
+		return ip
+	}
+	return peer
+}
+
+// parseIP returns the canonical form of the address in value.
+func parseIP(value string) (string, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil {
+		return "", false
+	}
+	return addr.Unmap().String(), true
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+var trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.0/24")}
+
+func TestAuthRequestHandler_Allowed(t *testing.T) {
+	limiter := &decisionLimiter{decision: ratelimit.Decision{Allowed: true, Limit: 20, Remaining: 19}}
+	req := httptest.NewRequest(http.MethodGet, "/authz", nil)
+	req.RemoteAddr = "10.0.0.2:8000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	req.Header.Set("API_KEY", "Token20")
+	rec := httptest.NewRecorder()
+
+	AuthRequestHandler(limiter, WithTrustedProxies(trustedProxies...)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	if limiter.ip != "203.0.113.9" || limiter.token != "Token20" {
+		t.Fatalf("expected forwarded client 203.0.113.9 with Token20, got %s %s", limiter.ip, limiter.token)
+	}
+
+	if rec.Header().Get("X-RateLimit-Remaining") != "19" {
+		t.Fatalf("expected X-RateLimit-Remaining 19, got %q", rec.Header().Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestAuthRequestHandler_Blocked(t *testing.T) {
+	limiter := &decisionLimiter{decision: ratelimit.Decision{Allowed: false, Limit: 20, RetryAfter: 30 * time.Second}}
+	req := httptest.NewRequest(http.MethodGet, "/authz/orders/1", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.4")
+	rec := httptest.NewRecorder()
+
+	AuthRequestHandler(limiter, WithTrustedProxies(trustedProxies...)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+
+	if limiter.ip != "198.51.100.4" {
+		t.Fatalf("expected the forwarded client, got %s", limiter.ip)
+	}
+
+	if rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestAuthRequestHandler_DenyStatusOverride(t *testing.T) {
+	limiter := &decisionLimiter{decision: ratelimit.Decision{Allowed: false, Limit: 20}}
+	req := httptest.NewRequest(http.MethodGet, "/authz?deny_status=403", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.4")
+	rec := httptest.NewRecorder()
+
+	AuthRequestHandler(limiter, WithTrustedProxies(trustedProxies...)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/authz?deny_status=200", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.4")
+	rec = httptest.NewRecorder()
+
+	AuthRequestHandler(limiter, WithTrustedProxies(trustedProxies...)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for non-error deny_status, got %d", rec.Code)
+	}
+}
+
+func TestForwardedClientIP_FallsBack(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/authz", nil)
+	req.RemoteAddr = "10.0.0.2:8000"
+	req.Header.Set("X-Envoy-External-Address", "198.51.100.1")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "198.51.100.1" {
+		t.Fatalf("expected Envoy external address, got %s", ip)
+	}
+
+	req.Header.Del("X-Envoy-External-Address")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "10.0.0.2" {
+		t.Fatalf("expected remote address, got %s", ip)
+	}
+
+	req.RemoteAddr = "invalid-address"
+	if ip := forwardedClientIP(req, trustedProxies); ip != "" {
+		t.Fatalf("expected empty address, got %s", ip)
+	}
+}
+
+func TestForwardedClientIP_IgnoresUntrustedPeers(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/authz", nil)
+	req.RemoteAddr = "203.0.113.7:8000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.4")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "203.0.113.7" {
+		t.Fatalf("expected headers from an untrusted peer to be ignored, got %s", ip)
+	}
+	if ip := forwardedClientIP(req, nil); ip != "203.0.113.7" {
+		t.Fatalf("expected no proxy to be trusted by default, got %s", ip)
+	}
+
+	// A client prepending its own hop cannot hide behind the trusted chain.
+	req.RemoteAddr = "10.0.0.2:8000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.4, 203.0.113.7, 10.0.0.1")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "203.0.113.7" {
+		t.Fatalf("expected the rightmost untrusted hop, got %s", ip)
+	}
+}
+
+func TestForwardedClientIP_IgnoresSpoofableValues(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/authz", nil)
+	req.RemoteAddr = "10.0.0.2:8000"
+	req.Header.Set("X-Real-IP", "198.51.100.4")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "10.0.0.2" {
+		t.Fatalf("expected X-Real-IP to be ignored, got %s", ip)
+	}
+
+	req.Header.Set("X-Forwarded-For", "victim-key")
+	req.Header.Set("X-Envoy-External-Address", "another-key")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "10.0.0.2" {
+		t.Fatalf("expected values that are not addresses to be ignored, got %s", ip)
+	}
+
+	req.Header.Set("X-Forwarded-For", "::ffff:198.51.100.4")
+	if ip := forwardedClientIP(req, trustedProxies); ip != "198.51.100.4" {
+		t.Fatalf("expected the canonical address, got %s", ip)
+	}
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/policy"
+)
+
+const (
+	contentTypeText    = "text/plain"
+	contentTypeProblem = "application/problem+json"
+	contentTypeJSON    = "application/json"
+	contentTypeHTML    = "text/html"
+)
+
+// problem is an RFC 9457 problem details object extended with the limit
+// that denied the request.
+type problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Instance   string `json:"instance,omitempty"`
+	Rule       string `json:"rule,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Remaining  *int   `json:"remaining,omitempty"`
+	Window     int    `json:"window,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// writeDenial answers a denied request in the representation its Accept
+// header prefers: RFC 9457 problem details for JSON clients, the rule's page
+// for browsers when it has one, and plain text otherwise.
+func writeDenial(w http.ResponseWriter, r *http.Request, rule *policy.Rule, decision ratelimit.Decision, status int, message string) {
+	var resp *policy.Response
+	denial := policy.Denial{
+		Status:     status,
+		Message:    message,
+		Limit:      decision.Limit,
+		Remaining:  max(decision.Remaining, 0),
+		Window:     seconds(decision.Window),
+		RetryAfter: seconds(decision.RetryAfter),
+	}
+	if rule != nil {
+		resp = rule.Response
+		denial.Rule = rule.Name
+		denial.Status = resp.StatusOr(status)
+	}
+
+	offers := []string{contentTypeText, contentTypeProblem, contentTypeJSON}
+	if resp.HasHTML() {
+		offers = append(offers, contentTypeHTML)
+	}
+	w.Header().Add("Vary", "Accept")
+
+	switch negotiate(r.Header.Get("Accept"), offers) {
+	case contentTypeProblem, contentTypeJSON:
+		body := problem{
+			Type:       "about:blank",
+			Title:      http.StatusText(denial.Status),
+			Status:     denial.Status,
+			Detail:     resp.RenderDetail(denial),
+			Instance:   r.URL.Path,
+			Rule:       denial.Rule,
+			Limit:      denial.Limit,
+			Window:     denial.Window,
+			Scope:      string(decision.Scope),
+			RetryAfter: denial.RetryAfter,
+		}
+		if resp != nil && resp.Type != "" {
+			body.Type = resp.Type
+		}
+		if resp != nil && resp.Title != "" {
+			body.Title = resp.Title
+		}
+		if decision.Limit > 0 {
+			body.Remaining = &denial.Remaining
+		}
+		w.Header().Set("Content-Type", contentTypeProblem)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(denial.Status)
+		_ = json.NewEncoder(w).Encode(body)
+	case contentTypeHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(denial.Status)
+		_ = resp.RenderHTML(w, denial)
+	default:
+		http.Error(w, resp.RenderDetail(denial), denial.Status)
+	}
+}
+
+// negotiate picks the offer with the highest quality in accept; ties go to
+// the earliest offer. A missing header accepts anything.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		if q := quality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// quality returns the q-value accept gives offer, using the most specific
+// matching media range.
+func quality(accept, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		rank := -1
+		switch {
+		case mediaType == offer:
+			rank = 2
+		case mediaType == offerType+"/*":
+			rank = 1
+		case mediaType == "*/*":
+			rank = 0
+		}
+		if rank <= specificity {
+			continue
+		}
+
+		value := 1.0
+		if raw, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				value = parsed
+			}
+		}
+		q, specificity = value, rank
+	}
+	return q
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/policy"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{contentTypeText, contentTypeProblem, contentTypeJSON, contentTypeHTML}
+	cases := map[string]string{
+		"":                                    contentTypeText,
+		"*/*":                                 contentTypeText,
+		"application/json":                    contentTypeJSON,
+		"application/problem+json, */*;q=0.1": contentTypeProblem,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": contentTypeHTML,
+		"application/*;q=0.5, text/plain;q=0.2":                           contentTypeProblem,
+		"image/png":                                                       contentTypeText,
+	}
+	for accept, expected := range cases {
+		if got := negotiate(accept, offers); got != expected {
+			t.Fatalf("Accept %q: expected %s, got %s", accept, expected, got)
+		}
+	}
+}
+
+func TestWriteDenial_ProblemDetails(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"search","response":{
+		"type":"https://example.com/problems/rate-limit",
+		"detail":"Limite de {{.Limit}} atingido, tente em {{.RetryAfter}}s"
+	}}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	rec := httptest.NewRecorder()
+	decision := ratelimit.Decision{Limit: 20, Window: time.Second, RetryAfter: 1500 * time.Millisecond}
+	writeDenial(rec, req, rules.Match(req), decision, http.StatusTooManyRequests, "Rate limit exceeded")
+
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid problem body: %v", err)
+	}
+	if body["type"] != "https://example.com/problems/rate-limit" || body["title"] != "Too Many Requests" ||
+		body["detail"] != "Limite de 20 atingido, tente em 2s" || body["rule"] != "search" ||
+		body["limit"] != 20.0 || body["remaining"] != 0.0 || body["retry_after"] != 2.0 || body["instance"] != "/search" {
+		t.Fatalf("unexpected problem body %v", body)
+	}
+}
+
+func TestWriteDenial_RuleStatusAndHTML(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"web","response":{
+		"status":503,
+		"html":"<h1>Calma!</h1><p>Volte em {{.RetryAfter}} segundos</p>"
+	}}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	writeDenial(rec, req, rules.Match(req), ratelimit.Decision{RetryAfter: 30 * time.Second}, http.StatusTooManyRequests, "Rate limit exceeded")
+
+	if rec.Code != http.StatusServiceUnavailable || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), "Volte em 30 segundos") {
+		t.Fatalf("unexpected page %q", rec.Body.String())
+	}
+
+	req.Header.Set("Accept", "text/plain")
+	rec = httptest.NewRecorder()
+	writeDenial(rec, req, rules.Match(req), ratelimit.Decision{}, http.StatusTooManyRequests, "Rate limit exceeded")
+	if rec.Code != http.StatusServiceUnavailable || strings.TrimSpace(rec.Body.String()) != "Rate limit exceeded" {
+		t.Fatalf("expected plain text fallback, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/jwt"
+	"github.com/xavierpms/rate-limiter/internal/policy"
+)
+
+type options struct {
+	policy policy.Policy
+	key    policy.KeyExtractor
+	jwt    *jwt.Verifier
+	claims jwt.ClaimMapping
+	cert   policy.CertField
+
+	trustedProxies []netip.Prefix
+}
+
+type Option func(*options)
+
+// WithPolicy matches each request against the policy rules, which decide how
+// much of the budget it consumes.
+func WithPolicy(p policy.Policy) Option {
+	return func(o *options) {
+		o.policy = p
+	}
+}
+
+// WithKeyExtractor counts requests by extractor instead of the client IP,
+// unless their rule sets its own key. Requests lacking the key fall back to
+// their IP.
+func WithKeyExtractor(extractor policy.KeyExtractor) Option {
+	return func(o *options) {
+		o.key = extractor
+	}
+}
+
+// WithJWT verifies the bearer token of each request and rejects the request
+// when the token is invalid or expired. Clients with a valid token are
+// counted by their subject instead of their IP, within their tenant, under
+// the limits of their tier; claims names those claims. Requests without a
+// token are counted as before.
+func WithJWT(verifier *jwt.Verifier, claims jwt.ClaimMapping) Option {
+	return func(o *options) {
+		o.jwt = verifier
+		o.claims = claims
+	}
+}
+
+// WithClientCert counts clients presenting a verified TLS certificate by
+// field of the certificate instead of their IP, and looks their limit up
+// with it as the token. A valid bearer token, under WithJWT, takes
+// precedence.
+func WithClientCert(field policy.CertField) Option {
+	return func(o *options) {
+		o.cert = field
+	}
+}
+
+// WithTrustedProxies lets the proxies in prefixes set the client address
+// through X-Forwarded-For or X-Envoy-External-Address.
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(o *options) {
+		o.trustedProxies = prefixes
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// keyOf returns the key of r under the default extractor, or ip.
+func (o options) keyOf(r *http.Request, ip string) string {
+	if o.key == nil {
+		return ip
+	}
+	if key, ok := o.key.Extract(r); ok {
+		return key
+	}
+	return ip
+}
+
+// clientCert returns the identity of the verified client certificate of r,
+// or "".
+func (o options) clientCert(r *http.Request) string {
+	if o.cert == "" {
+		return ""
+	}
+	return policy.ClientCertField(r, o.cert)
+}
+
+// authenticate verifies the bearer token of r, if any, and returns r carrying
+// its claims for the key extractors of the rules.
+func (o options) authenticate(r *http.Request) (*http.Request, ratelimit.Identity, string, error) {
+	if o.jwt == nil {
+		return r, ratelimit.Identity{}, "", nil
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return r, ratelimit.Identity{}, "", nil
+	}
+	claims, err := o.jwt.Verify(strings.TrimSpace(token))
+	if err != nil {
+		return r, ratelimit.Identity{}, "", err
+	}
+	identity, tier := o.claims.Identify(claims)
+	return r.WithContext(jwt.NewContext(r.Context(), claims)), identity, tier, nil
+}
@@ -1,15 +1,59 @@
 package middleware
 
 import (
+	"errors"
 	"net"
 	"net/http"
+	"strconv"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/policy"
 )
 
 type Limiter interface {
 	Allow(ip, token string) bool
 }
 
-func RateLimitMiddleware(next http.Handler, limiter Limiter) http.Handler {
+// DecisionLimiter is implemented by limiters that can report the quota behind
+// a verdict, which is then exposed through the X-RateLimit-* headers.
+type DecisionLimiter interface {
+	Check(ip, token string) ratelimit.Decision
+}
+
+// CostLimiter is implemented by limiters that can charge a request more than
+// one unit of the budget.
+type CostLimiter interface {
+	CheckCost(ip, token string, cost int) ratelimit.Decision
+}
+
+// RequestLimiter is implemented by limiters that understand policy rules,
+// such as rules with several windows.
+type RequestLimiter interface {
+	Evaluate(req ratelimit.Request) ratelimit.Decision
+}
+
+// ConcurrencyLimiter is implemented by limiters that also cap in-flight
+// requests. The slot is held until the downstream handler returns.
+type ConcurrencyLimiter interface {
+	Acquire(ip, token string) (release func(), decision ratelimit.Decision)
+}
+
+// PenaltyLimiter is implemented by limiters that block keys producing too
+// many bad responses. The middleware reports the status of every response
+// written by the downstream handler.
+type PenaltyLimiter interface {
+	Report(ip string, status int)
+}
+
+// LoginLimiter is implemented by limiters that lock accounts after too many
+// failed logins. The middleware reports the status of every attempt matched
+// by a login rule.
+type LoginLimiter interface {
+	RecordLogin(req ratelimit.Request, status int)
+}
+
+func RateLimitMiddleware(next http.Handler, limiter Limiter, opts ...Option) http.Handler {
+	o := newOptions(opts)
 
 	result := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -18,13 +62,177 @@ func RateLimitMiddleware(next http.Handler, limiter Limiter) http.Handler {
 			return
 		}
 
-		token := r.Header.Get("API_KEY")
-		if !limiter.Allow(ip, token) {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		r, identity, tier, err := o.authenticate(r)
+		if err != nil {
+			rejectToken(w, r, limiter, o.policy.Match(r), ip)
+			return
+		}
+		key, token := ip, ratelimit.ClientToken(r.Header.Get("API_KEY"))
+		if identity.Subject != "" {
+			key = "jwt:sub=" + identity.Subject
+		} else if cert := o.clientCert(r); cert != "" {
+			key, token = "cert:"+string(o.cert)+"="+cert, cert
+			identity.Subject = cert
+		}
+		if tier != "" {
+			token = ratelimit.TierToken(tier)
+		}
+
+		rule := o.policy.Match(r)
+		req := rule.Request(r, rule.KeyOf(r, o.keyOf(r, key)), token)
+		req.Identity = identity
+		if req.Lockout != nil {
+			account, err := rule.Account(r)
+			var invalid *policy.AccountError
+			if errors.As(err, &invalid) {
+				writeDenial(w, r, nil, ratelimit.Decision{}, invalid.Status, invalid.Reason)
+				return
+			}
+			req.Account = account
+		}
+		if shadow := o.policy.MatchShadow(r); shadow != nil {
+			shadowReq := shadow.Request(r, shadow.KeyOf(r, o.keyOf(r, key)), token)
+			req.Shadow = &shadowReq
+		}
+		if decision := evaluate(w, limiter, req); !decision.Allowed {
+			writeDenial(w, r, rule, decision, http.StatusTooManyRequests, denialMessage(decision))
+			return
+		}
+		if concurrent, ok := limiter.(ConcurrencyLimiter); ok {
+			release, decision := concurrent.Acquire(req.Key, token)
+			defer release()
+			if decision.Limit > 0 {
+				w.Header().Set("X-Concurrency-Limit", strconv.Itoa(decision.Limit))
+			}
+			if !decision.Allowed {
+				writeDenial(w, r, rule, decision, http.StatusTooManyRequests, "Too many concurrent requests")
+				return
+			}
+		}
+		penalized, reports := limiter.(PenaltyLimiter)
+		guarded, guards := limiter.(LoginLimiter)
+		guards = guards && req.Account != ""
+		if !reports && !guards {
+			next.ServeHTTP(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if reports {
+			penalized.Report(req.Key, recorder.status)
+		}
+		if guards {
+			guarded.RecordLogin(req, recorder.status)
+		}
 	})
 
 	return result
 }
+
+// rejectToken answers a request with an invalid bearer token. The attempt is
+// still charged to the client address and reported to the penalty box, so
+// guessing tokens is throttled like any other traffic.
+func rejectToken(w http.ResponseWriter, r *http.Request, limiter Limiter, rule *policy.Rule, ip string) {
+	if penalized, ok := limiter.(PenaltyLimiter); ok {
+		defer penalized.Report(ip, http.StatusUnauthorized)
+	}
+	if decision := evaluate(w, limiter, rule.Request(r, ip, "")); !decision.Allowed {
+		writeDenial(w, r, rule, decision, http.StatusTooManyRequests, denialMessage(decision))
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	writeDenial(w, r, nil, ratelimit.Decision{}, http.StatusUnauthorized, "Invalid token")
+}
+
+// evaluate asks the limiter for a verdict and writes the rate-limit headers
+// when the limiter is able to describe it. Limiters that cannot weigh
+// requests count every request as one.
+func evaluate(w http.ResponseWriter, limiter Limiter, req ratelimit.Request) ratelimit.Decision {
+	var decision ratelimit.Decision
+	if ruled, ok := limiter.(RequestLimiter); ok {
+		decision = ruled.Evaluate(req)
+	} else if weighted, ok := limiter.(CostLimiter); ok && req.Cost > 1 {
+		decision = weighted.CheckCost(req.Key, req.Token, req.Cost)
+	} else if detailed, ok := limiter.(DecisionLimiter); ok {
+		decision = detailed.Check(req.Key, req.Token)
+	} else {
+		return ratelimit.Decision{Allowed: limiter.Allow(req.Key, req.Token)}
+	}
+
+	// Rules in shadow mode stay invisible to clients, apart from a marker on
+	// the requests they would have denied.
+	if decision.ShadowDenied {
+		w.Header().Set("X-RateLimit-Shadow", "deny")
+	}
+	writeRateLimitHeaders(w.Header(), decision)
+	return decision
+}
+
+func denialMessage(decision ratelimit.Decision) string {
+	if decision.QuotaExceeded {
+		return "Quota exceeded"
+	}
+	if decision.Penalized {
+		return "Too many failed requests"
+	}
+	if decision.Locked {
+		return "Account temporarily locked"
+	}
+	return "Rate limit exceeded"
+}
+
+func writeRateLimitHeaders(header http.Header, decision ratelimit.Decision) {
+	if decision.Limit > 0 {
+		header.Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(max(decision.Remaining, 0)))
+		if decision.Cost > 1 {
+			header.Set("X-RateLimit-Cost", strconv.Itoa(decision.Cost))
+		}
+		if decision.Window > 0 {
+			header.Set("X-RateLimit-Window", strconv.Itoa(seconds(decision.Window)))
+		}
+		if decision.Scope != "" {
+			header.Set("X-RateLimit-Scope", string(decision.Scope))
+		}
+	}
+	if decision.Quota != nil {
+		header.Set("X-Quota-Limit", strconv.Itoa(decision.Quota.Limit))
+		header.Set("X-Quota-Remaining", strconv.Itoa(decision.Quota.Remaining))
+		header.Set("X-Quota-Reset", strconv.FormatInt(decision.Quota.ResetAt.Unix(), 10))
+	}
+	if !decision.Allowed && decision.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(seconds(decision.RetryAfter)))
+	}
+}
+
+// statusRecorder remembers the status written by the downstream handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(body []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(body)
+}
+
+// Flush keeps streaming responses, such as proxied ones, working.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
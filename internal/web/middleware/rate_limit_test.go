@@ -1,9 +1,21 @@
 package middleware
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/jwt"
+	"github.com/xavierpms/rate-limiter/internal/policy"
 )
 
 type spyLimiter struct {
@@ -85,4 +97,474 @@ func TestRateLimitMiddleware_InvalidRemoteAddr(t *testing.T) {
 	if rec.Code != http.StatusInternalServerError {
 		t.Fatalf("expected status 500, got %d", rec.Code)
 	}
-}
\ No newline at end of file
+}
+
+type decisionLimiter struct {
+	decision ratelimit.Decision
+	ip       string
+	token    string
+}
+
+func (d *decisionLimiter) Allow(ip, token string) bool {
+	return d.Check(ip, token).Allowed
+}
+
+func (d *decisionLimiter) Check(ip, token string) ratelimit.Decision {
+	d.ip = ip
+	d.token = token
+	return d.decision
+}
+
+func TestRateLimitMiddleware_WritesRateLimitHeaders(t *testing.T) {
+	limiter := &decisionLimiter{decision: ratelimit.Decision{Allowed: true, Limit: 10, Remaining: 7}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handler := RateLimitMiddleware(next, limiter)
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("X-RateLimit-Limit") != "10" || rec.Header().Get("X-RateLimit-Remaining") != "7" {
+		t.Fatalf("unexpected rate limit headers: %v", rec.Header())
+	}
+
+	if rec.Header().Get("Retry-After") != "" {
+		t.Fatal("did not expect Retry-After on allowed request")
+	}
+}
+
+func TestRateLimitMiddleware_WritesRetryAfterWhenBlocked(t *testing.T) {
+	limiter := &decisionLimiter{decision: ratelimit.Decision{Allowed: false, Limit: 10, RetryAfter: 1500 * time.Millisecond}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called when blocked")
+	})
+
+	handler := RateLimitMiddleware(next, limiter)
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rec.Code)
+	}
+
+	if rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	if rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected X-RateLimit-Remaining 0, got %q", rec.Header().Get("X-RateLimit-Remaining"))
+	}
+}
+
+type concurrencyLimiter struct {
+	spyLimiter
+	inFlight int
+	limit    int
+	released int
+}
+
+func (c *concurrencyLimiter) Acquire(ip, token string) (func(), ratelimit.Decision) {
+	if c.inFlight >= c.limit {
+		return func() {}, ratelimit.Decision{Allowed: false, Limit: c.limit}
+	}
+	c.inFlight++
+	return func() {
+		c.inFlight--
+		c.released++
+	}, ratelimit.Decision{Allowed: true, Limit: c.limit}
+}
+
+func TestRateLimitMiddleware_ConcurrencyLimit(t *testing.T) {
+	limiter := &concurrencyLimiter{spyLimiter: spyLimiter{allow: true}, limit: 1}
+	var nested *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nested == nil {
+			nested = httptest.NewRecorder()
+			handler.ServeHTTP(nested, r)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), limiter)
+
+	req := httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected outer request to be served, got %d", rec.Code)
+	}
+	if nested.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected concurrent request to get 429, got %d", nested.Code)
+	}
+	if rec.Header().Get("X-Concurrency-Limit") != "1" {
+		t.Fatalf("expected X-Concurrency-Limit 1, got %q", rec.Header().Get("X-Concurrency-Limit"))
+	}
+	if limiter.inFlight != 0 || limiter.released != 1 {
+		t.Fatalf("expected slot to be released, in flight %d released %d", limiter.inFlight, limiter.released)
+	}
+}
+
+type costLimiter struct {
+	decisionLimiter
+	cost int
+}
+
+func (c *costLimiter) CheckCost(ip, token string, cost int) ratelimit.Decision {
+	c.cost = cost
+	return ratelimit.Decision{Allowed: true, Limit: 1000, Remaining: 1000 - cost, Cost: cost}
+}
+
+func TestRateLimitMiddleware_ChargesRuleCost(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"bulk","path_prefix":"/bulk","cost":100}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	limiter := &costLimiter{decisionLimiter: decisionLimiter{decision: ratelimit.Decision{Allowed: true, Limit: 1000, Remaining: 999, Cost: 1}}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := RateLimitMiddleware(next, limiter, WithPolicy(rules))
+
+	req := httptest.NewRequest(http.MethodPost, "/bulk/import", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if limiter.cost != 100 {
+		t.Fatalf("expected cost 100, got %d", limiter.cost)
+	}
+	if rec.Header().Get("X-RateLimit-Cost") != "100" || rec.Header().Get("X-RateLimit-Remaining") != "900" {
+		t.Fatalf("unexpected headers: %v", rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if limiter.ip != "127.0.0.1" || rec.Header().Get("X-RateLimit-Cost") != "" {
+		t.Fatalf("expected unmatched request to be checked at cost 1, headers %v", rec.Header())
+	}
+}
+
+func TestRateLimitMiddleware_QuotaExceeded(t *testing.T) {
+	resetAt := time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	limiter := &decisionLimiter{decision: ratelimit.Decision{
+		Allowed:       false,
+		Limit:         10,
+		Remaining:     9,
+		RetryAfter:    time.Hour,
+		Quota:         &ratelimit.QuotaStatus{Period: ratelimit.PeriodMonth, Limit: 1000, Remaining: 0, ResetAt: resetAt},
+		QuotaExceeded: true,
+	}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called when the quota is exhausted")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	RateLimitMiddleware(next, limiter).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "Quota exceeded") {
+		t.Fatalf("expected quota denial, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Quota-Limit") != "1000" || rec.Header().Get("X-Quota-Remaining") != "0" || rec.Header().Get("X-Quota-Reset") != "1793491200" {
+		t.Fatalf("unexpected quota headers: %v", rec.Header())
+	}
+	if rec.Header().Get("Retry-After") != "3600" {
+		t.Fatalf("expected Retry-After 3600, got %q", rec.Header().Get("Retry-After"))
+	}
+}
+
+type requestLimiter struct {
+	decisionLimiter
+	req ratelimit.Request
+}
+
+func (l *requestLimiter) Evaluate(req ratelimit.Request) ratelimit.Decision {
+	l.req = req
+	return ratelimit.Decision{Allowed: false, Limit: 300, Remaining: 0, Window: time.Minute, RetryAfter: 12 * time.Second}
+}
+
+func TestRateLimitMiddleware_ReportsMostRestrictiveWindow(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"search","windows":[{"limit":20,"window":"1s"},{"limit":300,"window":"1m"}]}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	limiter := &requestLimiter{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next handler should not be called when blocked")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	RateLimitMiddleware(next, limiter, WithPolicy(rules)).ServeHTTP(rec, req)
+
+	if limiter.req.Rule != "search" || len(limiter.req.Windows) != 2 {
+		t.Fatalf("expected rule windows to reach the limiter, got %#v", limiter.req)
+	}
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("X-RateLimit-Limit") != "300" || rec.Header().Get("X-RateLimit-Window") != "60" {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+}
+
+type penaltyLimiter struct {
+	spyLimiter
+	reported []int
+}
+
+func (p *penaltyLimiter) Report(ip string, status int) {
+	p.reported = append(p.reported, status)
+}
+
+func TestRateLimitMiddleware_ReportsResponseStatus(t *testing.T) {
+	limiter := &penaltyLimiter{spyLimiter: spyLimiter{allow: true}}
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}), limiter)
+
+	for _, path := range []string{"/missing", "/hello"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(limiter.reported) != 2 || limiter.reported[0] != http.StatusNotFound || limiter.reported[1] != http.StatusOK {
+		t.Fatalf("expected statuses 404 and 200 to be reported, got %v", limiter.reported)
+	}
+
+	limiter.allow = false
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if len(limiter.reported) != 2 {
+		t.Fatalf("expected denied requests not to be reported, got %v", limiter.reported)
+	}
+}
+
+type shadowLimiter struct {
+	spyLimiter
+	req ratelimit.Request
+}
+
+func (l *shadowLimiter) Evaluate(req ratelimit.Request) ratelimit.Decision {
+	l.req = req
+	return ratelimit.Decision{Allowed: true, Limit: 5, ShadowDenied: req.Shadow != nil}
+}
+
+func TestRateLimitMiddleware_MarksShadowDenials(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"strict","path_prefix":"/strict","shadow":true}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	limiter := &shadowLimiter{}
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), limiter, WithPolicy(rules))
+
+	req := httptest.NewRequest(http.MethodGet, "/strict", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Shadow") != "deny" {
+		t.Fatalf("expected request to pass marked as a shadow denial, got %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Fatalf("expected the enforced limits to be reported, got %v", rec.Header())
+	}
+	if limiter.req.Rule != "" || limiter.req.Shadow == nil || limiter.req.Shadow.Rule != "strict" {
+		t.Fatalf("expected the shadow rule to be evaluated next to the enforced one, got %#v", limiter.req)
+	}
+}
+
+func TestRateLimitMiddleware_RejectsLoginWithoutAccount(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[
+		{"name":"login","path_prefix":"/login","login":{"field":"username","max_failures":5,"window":"15m","lockout":"30m"}}
+	]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	limiter := &shadowLimiter{}
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), limiter, WithPolicy(rules))
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=alice"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType || limiter.req.Lockout != nil {
+		t.Fatalf("expected status 415 before the limiter runs, got %d %#v", rec.Code, limiter.req)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=alice"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "127.0.0.1:12345"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || limiter.req.Account != "alice" {
+		t.Fatalf("expected the account to be limited, got %d %#v", rec.Code, limiter.req)
+	}
+}
+
+func TestRateLimitMiddleware_UsesRuleKey(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"partners","path_prefix":"/partners","key":"header:X-Client-Id"}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	limiter := &requestLimiter{}
+	defaultKey, _ := policy.ParseKeyExtractor("ip+path")
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), limiter,
+		WithPolicy(rules), WithKeyExtractor(defaultKey))
+
+	cases := map[string]string{
+		"/partners/orders": "header:x-client-id=acme",
+		"/hello":           "127.0.0.1|path=/hello",
+	}
+	for path, expected := range cases {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("X-Client-Id", "acme")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if limiter.req.Key != expected {
+			t.Fatalf("%s: expected key %q, got %q", path, expected, limiter.req.Key)
+		}
+	}
+}
+
+func hs256(secret, payload string) string {
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestRateLimitMiddleware_VerifiesJWT(t *testing.T) {
+	rules, err := policy.Parse([]byte(`{"rules":[{"name":"orgs","path_prefix":"/orgs","key":"jwt:org"}]}`))
+	if err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	verifier := jwt.NewVerifier()
+	verifier.AddSecret([]byte("secret"))
+	limiter := &requestLimiter{}
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), limiter,
+		WithPolicy(rules), WithJWT(verifier, jwt.ClaimMapping{}))
+
+	serve := func(path, authorization string) *httptest.ResponseRecorder {
+		limiter.req = ratelimit.Request{}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("API_KEY", "Token20")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	token := hs256("secret", `{"sub":"alice","org":"acme","plan":"pro","exp":4102444800}`)
+	serve("/hello", "Bearer "+token)
+	if limiter.req.Key != "jwt:sub=alice" || limiter.req.Token != "tier:pro" || limiter.req.Identity != (ratelimit.Identity{Subject: "alice", Tenant: "acme"}) {
+		t.Fatalf("expected request to be counted by its verified identity, got %#v", limiter.req)
+	}
+	serve("/orgs/1", "Bearer "+token)
+	if limiter.req.Key != "jwt:org=acme" {
+		t.Fatalf("expected rule key to read the verified claims, got %q", limiter.req.Key)
+	}
+
+	serve("/hello", "")
+	if limiter.req.Key != "127.0.0.1" || limiter.req.Token != "Token20" {
+		t.Fatalf("expected anonymous request to be counted by IP, got %#v", limiter.req)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	req.Header.Set("API_KEY", "tier:pro")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if limiter.req.Token != "" {
+		t.Fatalf("expected an API key posing as a tier to be ignored, got %q", limiter.req.Token)
+	}
+
+	for name, authorization := range map[string]string{
+		"forged":  "Bearer " + hs256("guess", `{"sub":"alice","plan":"enterprise"}`),
+		"expired": "Bearer " + hs256("secret", `{"sub":"alice","exp":946684800}`),
+	} {
+		rec := serve("/hello", authorization)
+		if rec.Code != http.StatusTooManyRequests || limiter.req.Key != "127.0.0.1" || limiter.req.Token != "" {
+			t.Fatalf("%s: expected the attempt to be charged to the client address, got %d %#v", name, rec.Code, limiter.req)
+		}
+	}
+}
+
+func TestRateLimitMiddleware_ThrottlesInvalidTokens(t *testing.T) {
+	verifier := jwt.NewVerifier()
+	verifier.AddSecret([]byte("secret"))
+	forged := "Bearer " + hs256("guess", `{"sub":"alice"}`)
+
+	for _, allow := range []bool{true, false} {
+		limiter := &penaltyLimiter{spyLimiter: spyLimiter{allow: allow}}
+		handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("next handler should not be called with an invalid token")
+		}), limiter, WithJWT(verifier, jwt.ClaimMapping{}))
+
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.Header.Set("Authorization", forged)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		expected := http.StatusUnauthorized
+		if !allow {
+			expected = http.StatusTooManyRequests
+		}
+		if rec.Code != expected || limiter.ip != "127.0.0.1" {
+			t.Fatalf("expected status %d charged to the client address, got %d %q", expected, rec.Code, limiter.ip)
+		}
+		if allow && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatal("expected WWW-Authenticate on 401")
+		}
+		if len(limiter.reported) != 1 || limiter.reported[0] != http.StatusUnauthorized {
+			t.Fatalf("expected the 401 to be reported to the penalty box, got %v", limiter.reported)
+		}
+	}
+}
+
+func TestRateLimitMiddleware_UsesClientCertIdentity(t *testing.T) {
+	limiter := &requestLimiter{}
+	handler := RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), limiter,
+		WithClientCert(policy.CertSAN))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "partner-a"}, DNSNames: []string{"partner-a.example.com"}}
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	req.Header.Set("API_KEY", "Token20")
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if limiter.req.Key != "127.0.0.1" || limiter.req.Token != "Token20" {
+		t.Fatalf("expected unverified certificate to be ignored, got %#v", limiter.req)
+	}
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if limiter.req.Key != "cert:san=partner-a.example.com" || limiter.req.Token != "partner-a.example.com" || limiter.req.Identity.Subject != "partner-a.example.com" {
+		t.Fatalf("expected request to be counted by its certificate, got %#v", limiter.req)
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/xavierpms/rate-limiter/internal/policy"
+)
+
+type Route struct {
+	Host       string
+	PathPrefix string
+	Upstream   *url.URL
+}
+
+type Proxy struct {
+	hostRoutes map[string]*httputil.ReverseProxy
+	pathRoutes []pathRoute
+	fallback   *httputil.ReverseProxy
+}
+
+type pathRoute struct {
+	prefix string
+	proxy  *httputil.ReverseProxy
+}
+
+// ParseRoutes reads a comma separated list of match=upstream pairs. A match
+// starting with "/" is a path prefix, anything else is a host name:
+// "api.example.com=http://api:8080,/reports=http://reports:9000".
+func ParseRoutes(spec string) ([]Route, error) {
+	routes := make([]Route, 0)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		match, rawUpstream, ok := strings.Cut(entry, "=")
+		match = strings.TrimSpace(match)
+		if !ok || match == "" {
+			return nil, fmt.Errorf("invalid proxy route %q: expected match=upstream", entry)
+		}
+
+		upstream, err := ParseUpstream(strings.TrimSpace(rawUpstream))
+		if err != nil {
+			return nil, err
+		}
+
+		route := Route{Upstream: upstream}
+		if strings.HasPrefix(match, "/") {
+			route.PathPrefix = match
+		} else {
+			route.Host = strings.ToLower(match)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func ParseUpstream(raw string) (*url.URL, error) {
+	upstream, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", raw, err)
+	}
+	if upstream.Scheme != "http" && upstream.Scheme != "https" {
+		return nil, fmt.Errorf("invalid upstream %q: scheme must be http or https", raw)
+	}
+	if upstream.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q: missing host", raw)
+	}
+	return upstream, nil
+}
+
+// New builds a proxy that forwards by exact host first, then by the longest
+// matching path prefix and finally to fallback, which may be nil.
+func New(routes []Route, fallback *url.URL) *Proxy {
+	p := &Proxy{hostRoutes: make(map[string]*httputil.ReverseProxy)}
+	for _, route := range routes {
+		if route.Host != "" {
+			p.hostRoutes[route.Host] = newReverseProxy(route.Upstream)
+			continue
+		}
+		p.pathRoutes = append(p.pathRoutes, pathRoute{prefix: route.PathPrefix, proxy: newReverseProxy(route.Upstream)})
+	}
+	if fallback != nil {
+		p.fallback = newReverseProxy(fallback)
+	}
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := p.match(r)
+	if target == nil {
+		http.Error(w, "no upstream configured for request", http.StatusBadGateway)
+		return
+	}
+	target.ServeHTTP(w, r)
+}
+
+func (p *Proxy) match(r *http.Request) *httputil.ReverseProxy {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if target, ok := p.hostRoutes[host]; ok {
+		return target
+	}
+
+	var best *pathRoute
+	for i := range p.pathRoutes {
+		route := &p.pathRoutes[i]
+		if policy.HasPathPrefix(r.URL.Path, route.prefix) && (best == nil || len(route.prefix) > len(best.prefix)) {
+			best = route
+		}
+	}
+	if best != nil {
+		return best.proxy
+	}
+	return p.fallback
+}
+
+func newReverseProxy(upstream *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Seen-Path", r.URL.Path)
+		w.Header().Set("X-Seen-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("API.example.com=http://api:8080, /reports=https://reports:9000,")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+
+	if routes[0].Host != "api.example.com" || routes[0].Upstream.Host != "api:8080" {
+		t.Fatalf("unexpected host route: %#v", routes[0])
+	}
+
+	if routes[1].PathPrefix != "/reports" || routes[1].Upstream.Scheme != "https" {
+		t.Fatalf("unexpected path route: %#v", routes[1])
+	}
+}
+
+func TestParseRoutes_Invalid(t *testing.T) {
+	for _, spec := range []string{"api.example.com", "=http://api:8080", "/reports=ftp://files", "/reports=http://"} {
+		if _, err := ParseRoutes(spec); err == nil {
+			t.Fatalf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestProxy_RoutesByHostPathAndFallback(t *testing.T) {
+	hostUpstream := newUpstream(t, "host")
+	reportsUpstream := newUpstream(t, "reports")
+	exportsUpstream := newUpstream(t, "exports")
+	defaultUpstream := newUpstream(t, "default")
+
+	routes, err := ParseRoutes("api.example.com=" + hostUpstream.URL + ",/reports=" + reportsUpstream.URL + ",/reports/exports=" + exportsUpstream.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fallback, err := ParseUpstream(defaultUpstream.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	proxy := New(routes, fallback)
+
+	cases := []struct {
+		host     string
+		path     string
+		upstream string
+	}{
+		{host: "api.example.com:8080", path: "/reports", upstream: "host"},
+		{host: "other.example.com", path: "/reports/daily", upstream: "reports"},
+		{host: "other.example.com", path: "/reports/exports/1", upstream: "exports"},
+		{host: "other.example.com", path: "/reports/exportsx", upstream: "reports"},
+		{host: "other.example.com", path: "/reportsx", upstream: "default"},
+		{host: "other.example.com", path: "/hello", upstream: "default"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Host = tc.host
+		req.RemoteAddr = "10.0.0.7:5000"
+		rec := httptest.NewRecorder()
+
+		proxy.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Upstream"); got != tc.upstream {
+			t.Fatalf("expected %s %s to reach %s, got %q", tc.host, tc.path, tc.upstream, got)
+		}
+		if got := rec.Header().Get("X-Seen-Path"); got != tc.path {
+			t.Fatalf("expected upstream to see path %s, got %s", tc.path, got)
+		}
+		if got := rec.Header().Get("X-Seen-Forwarded-For"); got != "10.0.0.7" {
+			t.Fatalf("expected X-Forwarded-For 10.0.0.7, got %q", got)
+		}
+	}
+}
+
+func TestProxy_NoUpstream(t *testing.T) {
+	proxy := New(nil, nil)
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	rec := httptest.NewRecorder()
+
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/pkg/ratelimit"
+)
+
+// The values below only compile while the structs keep every field they were
+// published with.
+var (
+	_ = ratelimit.State{Key: "", Count: 0, BlockedAt: 0, Strikes: 0}
+	_ = ratelimit.Decision{
+		Allowed: false, Limit: 0, Remaining: 0, Cost: 0, Window: time.Duration(0), Scope: ratelimit.ScopeKey,
+		RetryAfter: time.Duration(0), Quota: (*ratelimit.QuotaStatus)(nil),
+		QuotaExceeded: false, Penalized: false, Locked: false, ShadowDenied: false,
+	}
+	_ = ratelimit.Request{
+		Key: "", Token: "", Cost: 0, Rule: "", Windows: []ratelimit.Window(nil), Account: "",
+		Lockout: (*ratelimit.Lockout)(nil), Shadow: (*ratelimit.Request)(nil), Identity: ratelimit.Identity{},
+	}
+	_ = ratelimit.Identity{Subject: "", Tenant: ""}
+	_ = ratelimit.Lockout{MaxFailures: 0, Window: time.Duration(0), Duration: time.Duration(0), FailureStatuses: []int(nil)}
+	_ = ratelimit.Window{Limit: 0, Duration: time.Duration(0), Tokens: map[string]int(nil)}
+	_ = ratelimit.Quota{Period: ratelimit.PeriodDay, Limit: 0, Tokens: map[string]int(nil)}
+	_ = ratelimit.QuotaStatus{Period: ratelimit.PeriodMonth, Limit: 0, Remaining: 0, ResetAt: time.Time{}}
+	_ = ratelimit.QuotaBucket{Name: "", Limit: 0, ExpireAt: time.Time{}}
+	_ = ratelimit.Scope{Level: ratelimit.ScopeGlobal, Limit: 0, Duration: time.Duration(0), Overrides: map[string]int(nil)}
+	_ = ratelimit.Escalation{Multiplier: 0, Max: time.Duration(0), Decay: time.Duration(0)}
+)
+
+// The types below implement exactly the methods each interface was published
+// with: they stop compiling when a method is added, removed or retyped.
+type frozenStore struct{}
+
+func (frozenStore) Get(context.Context, string) (ratelimit.State, error) {
+	return ratelimit.State{}, nil
+}
+func (frozenStore) Save(context.Context, ratelimit.State) error { return nil }
+func (frozenStore) ListKeys(context.Context) ([]string, error)  { return nil, nil }
+func (frozenStore) Delete(context.Context, string) error        { return nil }
+
+type frozenCounterStore struct{ frozenStore }
+
+func (frozenCounterStore) Increment(context.Context, string, int) (ratelimit.State, error) {
+	return ratelimit.State{}, nil
+}
+
+type frozenConcurrencyStore struct{}
+
+func (frozenConcurrencyStore) Acquire(context.Context, string, string, int, time.Duration) (int, bool, error) {
+	return 0, false, nil
+}
+func (frozenConcurrencyStore) Release(context.Context, string, string) error { return nil }
+
+type frozenQuotaStore struct{}
+
+func (frozenQuotaStore) Consume(context.Context, string, int, []ratelimit.QuotaBucket) ([]int, int, error) {
+	return nil, -1, nil
+}
+
+type frozenPenaltyStore struct{}
+
+func (frozenPenaltyStore) Penalize(context.Context, string, int, time.Duration, time.Duration) (time.Time, error) {
+	return time.Time{}, nil
+}
+func (frozenPenaltyStore) ReleaseAt(context.Context, string) (time.Time, error) {
+	return time.Time{}, nil
+}
+func (frozenPenaltyStore) Clear(context.Context, string) error { return nil }
+
+type frozenTokenLimits struct{}
+
+func (frozenTokenLimits) LimitFor(string) int { return 0 }
+
+type frozenTenantProvider struct{}
+
+func (frozenTenantProvider) TenantFor(string) string { return "" }
+
+var (
+	_ ratelimit.Store            = frozenStore{}
+	_ ratelimit.CounterStore     = frozenCounterStore{}
+	_ ratelimit.ConcurrencyStore = frozenConcurrencyStore{}
+	_ ratelimit.QuotaStore       = frozenQuotaStore{}
+	_ ratelimit.PenaltyStore     = frozenPenaltyStore{}
+	_ ratelimit.TokenLimits      = frozenTokenLimits{}
+	_ ratelimit.TenantProvider   = frozenTenantProvider{}
+
+	// Method expressions fail to compile once a method is removed.
+	_ = ratelimit.Store.Get
+	_ = ratelimit.Store.Save
+	_ = ratelimit.Store.ListKeys
+	_ = ratelimit.Store.Delete
+	_ = ratelimit.CounterStore.Increment
+	_ = ratelimit.ConcurrencyStore.Acquire
+	_ = ratelimit.ConcurrencyStore.Release
+	_ = ratelimit.QuotaStore.Consume
+	_ = ratelimit.PenaltyStore.Penalize
+	_ = ratelimit.PenaltyStore.ReleaseAt
+	_ = ratelimit.PenaltyStore.Clear
+	_ = ratelimit.TokenLimits.LimitFor
+	_ = ratelimit.TenantProvider.TenantFor
+)
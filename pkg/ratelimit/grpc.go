@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+)
+
+// TokenMetadataKey is the metadata entry holding the API key whose limit
+// applies, mirroring the API_KEY header of the HTTP middleware.
+const TokenMetadataKey = "api_key"
+
+// DecisionLimiter is satisfied by *Limiter; the interceptors need the full
+// decision to report the retry delay.
+type DecisionLimiter interface {
+	Check(key, token string) Decision
+}
+
+// GRPCKeyFunc picks the key an RPC is counted under. An empty key falls back
+// to the peer address.
+type GRPCKeyFunc func(ctx context.Context, fullMethod string) string
+
+// KeyFromPeer counts RPCs per client IP.
+func KeyFromPeer(ctx context.Context, _ string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// KeyFromMetadata counts RPCs per value of the given metadata entry, such as
+// an API key.
+func KeyFromMetadata(name string) GRPCKeyFunc {
+	return func(ctx context.Context, _ string) string {
+		return firstMetadata(ctx, name)
+	}
+}
+
+// KeyFromMethod shares one budget between every caller of a method.
+func KeyFromMethod(_ context.Context, fullMethod string) string {
+	return fullMethod
+}
+
+type interceptorConfig struct {
+	key      GRPCKeyFunc
+	tokenKey string
+}
+
+type InterceptorOption func(*interceptorConfig)
+
+// WithGRPCKey replaces KeyFromPeer as the way RPCs are keyed.
+func WithGRPCKey(fn GRPCKeyFunc) InterceptorOption {
+	return func(c *interceptorConfig) { c.key = fn }
+}
+
+// WithTokenMetadata changes the metadata entry read as the API key.
+func WithTokenMetadata(name string) InterceptorOption {
+	return func(c *interceptorConfig) { c.tokenKey = name }
+}
+
+func UnaryServerInterceptor(limiter DecisionLimiter, opts ...InterceptorOption) grpc.UnaryServerInterceptor {
+	c := newInterceptorConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		decision := c.check(ctx, limiter, info.FullMethod)
+		_ = grpc.SetHeader(ctx, rateLimitMetadata(decision))
+		if !decision.Allowed {
+			return nil, exhausted(decision)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor checks the limit once, when the stream is opened.
+func StreamServerInterceptor(limiter DecisionLimiter, opts ...InterceptorOption) grpc.StreamServerInterceptor {
+	c := newInterceptorConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		decision := c.check(ss.Context(), limiter, info.FullMethod)
+		_ = ss.SetHeader(rateLimitMetadata(decision))
+		if !decision.Allowed {
+			return exhausted(decision)
+		}
+		return handler(srv, ss)
+	}
+}
+
+func newInterceptorConfig(opts []InterceptorOption) interceptorConfig {
+	c := interceptorConfig{key: KeyFromPeer, tokenKey: TokenMetadataKey}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c interceptorConfig) check(ctx context.Context, limiter DecisionLimiter, fullMethod string) Decision {
+	key := c.key(ctx, fullMethod)
+	if key == "" {
+		key = KeyFromPeer(ctx, fullMethod)
+	}
+	return limiter.Check(key, ratelimit.ClientToken(firstMetadata(ctx, c.tokenKey)))
+}
+
+func firstMetadata(ctx context.Context, name string) string {
+	values := metadata.ValueFromIncomingContext(ctx, name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func rateLimitMetadata(decision Decision) metadata.MD {
+	md := metadata.MD{}
+	if decision.Limit > 0 {
+		md.Set("x-ratelimit-limit", strconv.Itoa(decision.Limit))
+		md.Set("x-ratelimit-remaining", strconv.Itoa(max(decision.Remaining, 0)))
+	}
+	if decision.Quota != nil {
+		md.Set("x-quota-limit", strconv.Itoa(decision.Quota.Limit))
+		md.Set("x-quota-remaining", strconv.Itoa(decision.Quota.Remaining))
+	}
+	return md
+}
+
+// exhausted builds the ResourceExhausted status, carrying the block duration
+// as RetryInfo so clients can back off without guessing. Quota denials add a
+// QuotaFailure naming the exhausted period.
+func exhausted(decision Decision) error {
+	message := "rate limit exceeded"
+	details := make([]protoadapt.MessageV1, 0, 2)
+	if decision.QuotaExceeded && decision.Quota != nil {
+		message = "quota exceeded"
+		details = append(details, &errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     string(decision.Quota.Period),
+			Description: fmt.Sprintf("%s quota of %d exhausted", decision.Quota.Period, decision.Quota.Limit),
+		}}})
+	}
+	if decision.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(decision.RetryAfter)})
+	}
+
+	st := status.New(codes.ResourceExhausted, message)
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,114 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/xavierpms/rate-limiter/pkg/ratelimit"
+)
+
+func newHealthClient(t *testing.T, opts ...grpc.ServerOption) healthpb.HealthClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestUnaryServerInterceptor_ResourceExhausted(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.WithLimit(1), ratelimit.WithWindow(0), ratelimit.WithBlockDuration(30*time.Second))
+	defer limiter.Close()
+	client := newHealthClient(t, grpc.UnaryInterceptor(ratelimit.UnaryServerInterceptor(limiter)))
+
+	var header metadata.MD
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatalf("expected first call to succeed, got %v", err)
+	}
+	if got := header.Get("x-ratelimit-remaining"); len(got) != 1 || got[0] != "0" {
+		t.Fatalf("expected remaining header 0, got %v", got)
+	}
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected RetryInfo detail, got %v", details)
+	}
+	info, ok := details[0].(*errdetails.RetryInfo)
+	if !ok || info.GetRetryDelay().AsDuration() != 30*time.Second {
+		t.Fatalf("unexpected detail: %v", details[0])
+	}
+}
+
+func TestUnaryServerInterceptor_KeyFromMetadata(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.WithLimit(1), ratelimit.WithWindow(0))
+	defer limiter.Close()
+	client := newHealthClient(t, grpc.UnaryInterceptor(ratelimit.UnaryServerInterceptor(limiter, ratelimit.WithGRPCKey(ratelimit.KeyFromMetadata("api_key")))))
+
+	for _, key := range []string{"tenant-a", "tenant-b"} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "api_key", key)
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("expected %s to be allowed, got %v", key, err)
+		}
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "api_key", "tenant-a")
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected tenant-a to be limited, got %v", err)
+	}
+}
+
+func TestStreamServerInterceptor_KeyFromMethod(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.WithLimit(1), ratelimit.WithWindow(0))
+	defer limiter.Close()
+	client := newHealthClient(t, grpc.StreamInterceptor(ratelimit.StreamServerInterceptor(limiter, ratelimit.WithGRPCKey(ratelimit.KeyFromMethod))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := first.Recv(); err != nil {
+		t.Fatalf("expected first stream to be served, got %v", err)
+	}
+
+	second, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := second.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected second stream to be limited, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/xavierpms/rate-limiter/internal/jwt"
+	"github.com/xavierpms/rate-limiter/internal/policy"
+	"github.com/xavierpms/rate-limiter/internal/web/middleware"
+)
+
+// HTTPLimiter is satisfied by *Limiter and by any custom implementation. If it
+// also implements Check(ip, token string) Decision, the middleware writes the
+// X-RateLimit-* and Retry-After headers.
+type HTTPLimiter = middleware.Limiter
+
+type (
+	// Policy is a list of rules matched against each request in order.
+	Policy = policy.Policy
+	// Rule selects requests by host, path prefix and method and sets their cost.
+	Rule             = policy.Rule
+	MiddlewareOption = middleware.Option
+	// KeyExtractor derives the key a request is counted by.
+	KeyExtractor     = policy.KeyExtractor
+	KeyExtractorFunc = policy.KeyExtractorFunc
+	// JWTVerifier checks bearer tokens against local keys.
+	JWTVerifier = jwt.Verifier
+	// ClaimMapping names the claims holding the subject, tenant and tier.
+	ClaimMapping = jwt.ClaimMapping
+	// CertField is the part of a client certificate that identifies the client.
+	CertField = policy.CertField
+)
+
+const (
+	CertSubject     = policy.CertSubject
+	CertSAN         = policy.CertSAN
+	CertFingerprint = policy.CertFingerprint
+)
+
+// NewJWTVerifier returns a verifier without keys; add them with AddSecret,
+// AddPEM or AddJWKS.
+func NewJWTVerifier() *JWTVerifier {
+	return jwt.NewVerifier()
+}
+
+// LoadPolicy reads a JSON policy file in the RATELIMIT_POLICY_FILE format.
+func LoadPolicy(path string) (Policy, error) {
+	return policy.Load(path)
+}
+
+// WithRules charges each request the cost of the first matching rule.
+func WithRules(p Policy) MiddlewareOption {
+	return middleware.WithPolicy(p)
+}
+
+// ParseKeyExtractor builds a KeyExtractor from its policy form, such as
+// "header:X-Client-Id", "jwt:sub" or "ip+path".
+func ParseKeyExtractor(spec string) (KeyExtractor, error) {
+	return policy.ParseKeyExtractor(spec)
+}
+
+// WithKey counts requests by extractor instead of the client IP, unless the
+// matching rule sets its own key.
+func WithKey(extractor KeyExtractor) MiddlewareOption {
+	return middleware.WithKeyExtractor(extractor)
+}
+
+// WithJWT verifies bearer tokens, answering 401 for invalid or expired ones,
+// and counts authenticated clients by subject, tenant and tier. The limits
+// of a tier are looked up with the token "tier:<name>", which no API key
+// can select.
+func WithJWT(verifier *JWTVerifier, claims ClaimMapping) MiddlewareOption {
+	return middleware.WithJWT(verifier, claims)
+}
+
+// WithClientCert counts clients presenting a verified TLS certificate by
+// field of the certificate, which also selects their token limit.
+func WithClientCert(field CertField) MiddlewareOption {
+	return middleware.WithClientCert(field)
+}
+
+// WithTrustedProxies lets the proxies in prefixes set the client address of
+// the auth_request endpoint through the X-Forwarded-For and
+// X-Envoy-External-Address headers.
+func WithTrustedProxies(prefixes ...netip.Prefix) MiddlewareOption {
+	return middleware.WithTrustedProxies(prefixes...)
+}
+
+// Middleware limits requests by client IP, using the API_KEY header to pick a
+// token limit, and answers 429 when the limit is exceeded.
+func Middleware(limiter HTTPLimiter, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return middleware.RateLimitMiddleware(next, limiter, opts...)
+	}
+}
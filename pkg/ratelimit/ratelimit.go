@@ -0,0 +1,244 @@
+// Package ratelimit is the importable entry point to the rate limiter: the
+// limiter itself, the store contracts it persists state through and the
+// net/http middleware that enforces it.
+//
+// The types below alias the service's internal definitions so both always
+// agree, but they are this package's stable API. Structs are append-only:
+// fields are added, never renamed, removed or retyped. Interfaces are
+// frozen, since any new method breaks their implementations; a new
+// capability comes as a separate optional interface, detected with a type
+// assertion, as TenantProvider is for TokenLimits. api_test.go pins the
+// current surface so a breaking change fails to compile.
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/xavierpms/rate-limiter/internal/domain/ratelimit"
+	"github.com/xavierpms/rate-limiter/internal/ports"
+	"github.com/xavierpms/rate-limiter/internal/usecase"
+)
+
+type (
+	// State is the per-key counter persisted in a Store.
+	State = ratelimit.State
+	// Decision describes the verdict for a single request.
+	Decision = ratelimit.Decision
+	// Request is what Limiter.Evaluate checks: a key, its token, the cost
+	// and the windows of the rule it matched.
+	Request = ratelimit.Request
+	Window  = ratelimit.Window
+	// Identity is who a request authenticated as; Lockout guards the
+	// account of a login request.
+	Identity = ratelimit.Identity
+	Lockout  = ratelimit.Lockout
+	// Store persists State; implement it to plug in a custom backend.
+	Store = ports.RateLimitStateRepository
+	// CounterStore is a Store able to add to a counter atomically.
+	CounterStore = ports.RateLimitCounterRepository
+	// ConcurrencyStore holds the in-flight leases of each key.
+	ConcurrencyStore = ports.ConcurrencyRepository
+	// QuotaStore keeps daily and monthly counters apart from the rate state,
+	// one QuotaBucket per counter.
+	QuotaStore  = ports.QuotaRepository
+	QuotaBucket = ports.QuotaBucket
+	// PenaltyStore counts bad responses and holds the boxed keys.
+	PenaltyStore = ports.PenaltyRepository
+	// Quota is a daily or monthly budget; QuotaStatus reports its usage.
+	Quota       = ratelimit.Quota
+	QuotaStatus = ratelimit.QuotaStatus
+	// Scope is a budget shared by every request of the service, a tenant or
+	// an API key, consumed on top of the per-IP limit.
+	Scope = ratelimit.Scope
+	// Escalation lengthens the block of repeat offenders.
+	Escalation = ratelimit.Escalation
+	// TokenLimits resolves the limit of an API token, 0 meaning "use the
+	// default".
+	TokenLimits = ports.TokenLimitProvider
+	// TenantProvider is optionally implemented by TokenLimits to name the
+	// tenant owning each token.
+	TenantProvider = ports.TenantProvider
+	// Limiter decides whether a key may proceed. Close it to stop its
+	// background cleanup loop.
+	Limiter = usecase.RateLimiter
+)
+
+const (
+	PeriodDay   = ratelimit.PeriodDay
+	PeriodMonth = ratelimit.PeriodMonth
+
+	ScopeGlobal = ratelimit.ScopeGlobal
+	ScopeTenant = ratelimit.ScopeTenant
+	ScopeKey    = ratelimit.ScopeKey
+)
+
+// ErrStateNotFound must be returned by Store.Get for unknown keys.
+var ErrStateNotFound = ports.ErrStateNotFound
+
+// defaultMaxKeys bounds each of the in-memory stores used when none is set.
+const defaultMaxKeys = 100000
+
+type config struct {
+	ctx           context.Context
+	limit         int
+	window        time.Duration
+	blockDuration time.Duration
+	tokenLimits   TokenLimits
+	store         Store
+	failOpen      bool
+	extensions    []usecase.Option
+}
+
+type Option func(*config)
+
+// WithLimit sets the number of requests allowed per window. Defaults to 10.
+func WithLimit(limit int) Option {
+	return func(c *config) { c.limit = limit }
+}
+
+// WithWindow sets how often every counter is reset. Defaults to one second;
+// zero disables the reset loop.
+func WithWindow(window time.Duration) Option {
+	return func(c *config) { c.window = window }
+}
+
+// WithBlockDuration sets how long a key stays blocked after exceeding its
+// limit. Defaults to one minute.
+func WithBlockDuration(blockDuration time.Duration) Option {
+	return func(c *config) { c.blockDuration = blockDuration }
+}
+
+// WithEscalation multiplies the block duration each time a key is blocked
+// again before its strikes decay, up to a cap.
+func WithEscalation(escalation Escalation) Option {
+	return func(c *config) {
+		c.extensions = append(c.extensions, usecase.WithEscalation(escalation))
+	}
+}
+
+func WithTokenLimits(tokenLimits TokenLimits) Option {
+	return func(c *config) { c.tokenLimits = tokenLimits }
+}
+
+// WithStore sets where state is kept. Defaults to an in-memory store holding
+// up to 100000 keys.
+func WithStore(store Store) Option {
+	return func(c *config) { c.store = store }
+}
+
+// WithFailOpen lets requests through when the store fails instead of
+// rejecting them.
+func WithFailOpen(failOpen bool) Option {
+	return func(c *config) { c.failOpen = failOpen }
+}
+
+// WithConcurrencyLimit caps the requests of a key in flight at once. Slots
+// expire after lease even if never released, so lease should exceed the
+// slowest request. A nil store keeps the leases in memory.
+func WithConcurrencyLimit(limit int, lease time.Duration, store ConcurrencyStore) Option {
+	return func(c *config) {
+		if store == nil {
+			store = NewMemoryConcurrencyStore()
+		}
+		c.extensions = append(c.extensions, usecase.WithConcurrencyLimit(limit, lease, store))
+	}
+}
+
+// WithPenaltyBox blocks a key for block once threshold of its responses
+// within window had one of statuses, such as 401, 403 and 404. Only the
+// HTTP middleware reports responses. A nil store keeps the counters in
+// memory.
+func WithPenaltyBox(statuses []int, threshold int, window, block time.Duration, store PenaltyStore) Option {
+	return func(c *config) {
+		if store == nil {
+			store = NewMemoryPenaltyStore(defaultMaxKeys)
+		}
+		c.extensions = append(c.extensions, usecase.WithPenaltyBox(statuses, threshold, window, block, store))
+	}
+}
+
+// WithLockoutStore sets where failed logins and locked accounts are kept.
+// Defaults to memory.
+func WithLockoutStore(store PenaltyStore) Option {
+	return func(c *config) {
+		c.extensions = append(c.extensions, usecase.WithLockoutStore(store))
+	}
+}
+
+// WithQuotas adds daily or monthly quotas aligned to the calendar of
+// location. A nil store keeps the counters in memory.
+func WithQuotas(location *time.Location, store QuotaStore, quotas ...Quota) Option {
+	return func(c *config) {
+		if store == nil {
+			store = NewMemoryQuotaStore(defaultMaxKeys)
+		}
+		c.extensions = append(c.extensions, usecase.WithQuotas(quotas, location, store))
+	}
+}
+
+// WithWindowStore sets where the counters of multi-window rules are kept.
+// Defaults to memory.
+func WithWindowStore(store QuotaStore) Option {
+	return func(c *config) {
+		c.extensions = append(c.extensions, usecase.WithBucketStore(store))
+	}
+}
+
+// WithScopes adds global, tenant and key budgets. Tenants come from the
+// verified identity of the request or, when TokenLimits implements
+// TenantProvider, from the tenant owning its token or subject. The counters
+// live in the window store.
+func WithScopes(scopes ...Scope) Option {
+	return func(c *config) {
+		c.extensions = append(c.extensions, usecase.WithScopes(scopes))
+	}
+}
+
+// WithContext bounds the lifetime of the background loops and store calls.
+func WithContext(ctx context.Context) Option {
+	return func(c *config) { c.ctx = ctx }
+}
+
+// New builds a Limiter from the defaults overridden by opts.
+func New(opts ...Option) *Limiter {
+	c := config{
+		ctx:           context.Background(),
+		limit:         10,
+		window:        time.Second,
+		blockDuration: time.Minute,
+		tokenLimits:   TokenLimitMap(nil),
+		extensions: []usecase.Option{
+			usecase.WithBucketStore(NewMemoryQuotaStore(defaultMaxKeys)),
+			usecase.WithLockoutStore(NewMemoryPenaltyStore(defaultMaxKeys)),
+		},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.store == nil {
+		c.store = NewMemoryStore(defaultMaxKeys, 0)
+	}
+
+	return usecase.NewIpRateLimiter(
+		c.ctx,
+		c.limit,
+		c.window,
+		c.blockDuration,
+		c.tokenLimits,
+		c.store,
+		append(c.extensions, usecase.WithFailOpen(c.failOpen))...,
+	)
+}
+
+// TokenLimitMap adapts a token to limit map to TokenLimits. Its tokens
+// belong to no tenant.
+type TokenLimitMap map[string]int
+
+func (m TokenLimitMap) LimitFor(token string) int {
+	return m[token]
+}
+
+func (m TokenLimitMap) TenantFor(token string) string {
+	return ""
+}
@@ -0,0 +1,86 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/xavierpms/rate-limiter/pkg/ratelimit"
+)
+
+func TestNew_DefaultsToMemoryStore(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.WithLimit(2), ratelimit.WithWindow(0))
+	defer limiter.Close()
+
+	if !limiter.Allow("10.0.0.1", "") || !limiter.Allow("10.0.0.1", "") {
+		t.Fatal("expected first two requests to be allowed")
+	}
+	if limiter.Allow("10.0.0.1", "") {
+		t.Fatal("expected third request to be blocked")
+	}
+	if !limiter.Allow("10.0.0.2", "") {
+		t.Fatal("expected other key to be allowed")
+	}
+}
+
+func TestNew_TokenLimits(t *testing.T) {
+	limiter := ratelimit.New(
+		ratelimit.WithLimit(1),
+		ratelimit.WithWindow(0),
+		ratelimit.WithTokenLimits(ratelimit.TokenLimitMap{"premium": 3}),
+	)
+	defer limiter.Close()
+
+	decision := limiter.Check("10.0.0.1", "premium")
+	if !decision.Allowed || decision.Limit != 3 || decision.Remaining != 2 {
+		t.Fatalf("unexpected decision: %+v", decision)
+	}
+}
+
+func TestNew_RedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	limiter := ratelimit.New(
+		ratelimit.WithLimit(1),
+		ratelimit.WithWindow(0),
+		ratelimit.WithBlockDuration(time.Minute),
+		ratelimit.WithStore(ratelimit.NewRedisStore(client)),
+	)
+	defer limiter.Close()
+
+	limiter.Allow("10.0.0.1", "")
+	if limiter.Allow("10.0.0.1", "") {
+		t.Fatal("expected second request to be blocked")
+	}
+	if !mr.Exists("{10.0.0.1}") {
+		t.Fatal("expected state to be stored in redis")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.WithLimit(1), ratelimit.WithWindow(0))
+	defer limiter.Close()
+
+	handler := ratelimit.Middleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	statuses := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		statuses = append(statuses, rec.Code)
+	}
+
+	if statuses[0] != http.StatusNoContent || statuses[1] != http.StatusTooManyRequests {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/xavierpms/rate-limiter/internal/database"
+)
+
+// NewMemoryStore keeps state in process memory, evicting the least recently
+// used keys beyond maxKeys and expiring keys idle for ttl; zero disables either.
+func NewMemoryStore(maxKeys int, ttl time.Duration) Store {
+	return database.NewMemoryRateLimitRepository(0, maxKeys, ttl)
+}
+
+// NewRedisStore shares state between replicas through an existing go-redis
+// client (single node, Sentinel or Cluster).
+func NewRedisStore(client redis.UniversalClient) CounterStore {
+	return database.NewRedisRateLimitRepository(&database.RedisClient{Client: client})
+}
+
+func NewMemoryConcurrencyStore() ConcurrencyStore {
+	return database.NewMemoryConcurrencyRepository()
+}
+
+// NewRedisConcurrencyStore shares in-flight leases between replicas.
+func NewRedisConcurrencyStore(client redis.UniversalClient) ConcurrencyStore {
+	return database.NewRedisConcurrencyRepository(&database.RedisClient{Client: client})
+}
+
+// NewMemoryQuotaStore keeps quota and window counters in process memory, up
+// to maxKeys; zero disables the bound. Once full, new counters are refused
+// until others expire, rather than resetting a live quota.
+func NewMemoryQuotaStore(maxKeys int) QuotaStore {
+	return database.NewMemoryQuotaRepository(maxKeys)
+}
+
+// NewRedisQuotaStore persists quota counters in Redis, where they expire at
+// the end of their period instead of being reset by the cleanup loop.
+func NewRedisQuotaStore(client redis.UniversalClient) QuotaStore {
+	return database.NewRedisQuotaRepository(&database.RedisClient{Client: client})
+}
+
+// NewMemoryPenaltyStore keeps bad-response counters and boxed keys in process
+// memory, up to maxKeys each; zero disables the bound. Once full, new keys
+// are refused until others expire, rather than releasing a boxed key.
+func NewMemoryPenaltyStore(maxKeys int) PenaltyStore {
+	return database.NewMemoryPenaltyRepository(maxKeys)
+}
+
+// NewRedisPenaltyStore shares bad-response counters and boxed keys between
+// replicas.
+func NewRedisPenaltyStore(client redis.UniversalClient) PenaltyStore {
+	return database.NewRedisPenaltyRepository(&database.RedisClient{Client: client})
+}